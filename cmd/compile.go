@@ -1,18 +1,40 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/optimizers"
 	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
 
 	"github.com/spf13/cobra"
 )
 
+// definitions given via the command-line
+var compileDefinitions []string
+
+// directories that are searched for included files
+var compileIncludePaths []string
+
+// if true, write a source-map for every generated file
+var compileSourceMap bool
+
+// if true, assertions and debug-blocks are removed from the generated code
+var compileRelease bool
+
+// if true, print how the generated lines have been created
+var compileExplain bool
+
+// the optimization-level (0, s or fast)
+var compileLevel string
+
 // compileCmd represents the compile command
 var compileCmd = &cobra.Command{
 	Use:   "compile [file]+",
@@ -26,23 +48,51 @@ var compileCmd = &cobra.Command{
 	Args: cobra.MinimumNArgs(1),
 }
 
+// compilation is the result of compiling a nolol-file
+type compilation struct {
+	// the generated yolol-code for every chip
+	chips []string
+	// a source-map for every chip
+	sourcemaps []*nolol.SourceMap
+	// the warnings produced by the compiler
+	warnings parser.Errors
+	// how the lines of every chip have been created
+	explanations []*nolol.Explanation
+}
+
 func compileFile(fpath string) {
 	outfile := strings.Replace(fpath, path.Ext(fpath), ".yolol", -1)
-	converter := nolol.NewConverter()
-	converter.Debug(debugLog)
-	converted, compileerr := converter.ConvertFile(fpath)
+	result, compileerr := compileWithOptimizations(fpath, optimizationPasses)
+
+	if compileExplain {
+		printExplanation(result)
+	}
 
 	// compilation failed completely. Fail now!
-	if converted == nil {
+	if result.chips == nil {
 		exitOnError(compileerr, "converting to yolol")
 	}
 
-	gen := parser.Printer{}
-	gen.Mode = parser.PrintermodeCompact
-	generated, err := gen.Print(converted)
-	exitOnError(err, "generating code")
-	err = ioutil.WriteFile(outfile, []byte(generated), 0700)
-	exitOnError(err, "writing file")
+	for _, warning := range result.warnings {
+		fmt.Printf("Warning at %s: %s\n", warning.StartPosition, warning.Message)
+	}
+
+	generated := result.chips
+	sourcemaps := result.sourcemaps
+
+	if optimizationReport {
+		printCompilationReport(fpath, generated)
+	}
+
+	if len(generated) == 1 {
+		err := ioutil.WriteFile(outfile, []byte(generated[0]), 0700)
+		exitOnError(err, "writing file")
+		if compileSourceMap {
+			writeSourceMap(outfile, sourcemaps[0])
+		}
+	} else {
+		writeChips(fpath, generated, sourcemaps)
+	}
 
 	if compileerr != nil {
 		fmt.Println("Compilation succeeded with errors. Please check the output:", compileerr)
@@ -51,8 +101,168 @@ func compileFile(fpath string) {
 
 }
 
+// writeChips writes one yolol-file per chip and (if it does not exist yet) a test-file that runs all chips together
+func writeChips(fpath string, chips []string, sourcemaps []*nolol.SourceMap) {
+	base := strings.TrimSuffix(fpath, path.Ext(fpath))
+	scripts := ""
+	for i, code := range chips {
+		outfile := fmt.Sprintf("%s_%d.yolol", base, i+1)
+		err := ioutil.WriteFile(outfile, []byte(code), 0700)
+		exitOnError(err, "writing file")
+		fmt.Println("Wrote chip", i+1, "to:", outfile)
+		if compileSourceMap {
+			writeSourceMap(outfile, sourcemaps[i])
+		}
+		scripts += fmt.Sprintf("  - name: %s\n    maxlines: %d\n", path.Base(outfile), 100*len(chips))
+	}
+
+	testfile := base + "_chips_test.yaml"
+	if _, err := os.Stat(testfile); err == nil {
+		return
+	}
+	test := "# runs all chips of " + path.Base(fpath) + " together. Add inputs and expected outputs to the case\n" +
+		"scripts:\n" + scripts +
+		"cases:\n" +
+		"  - name: TestChips\n" +
+		"    inputs: {}\n" +
+		"    outputs: {}\n"
+	err := ioutil.WriteFile(testfile, []byte(test), 0700)
+	exitOnError(err, "writing test-file")
+	fmt.Println("Wrote test-skeleton to:", testfile)
+}
+
+// writeSourceMap writes the source-map for the given yolol-file to <yololfile>.map
+func writeSourceMap(yololfile string, sm *nolol.SourceMap) {
+	sm.File = path.Base(yololfile)
+	content, err := json.MarshalIndent(sm, "", "  ")
+	exitOnError(err, "generating source-map")
+	err = ioutil.WriteFile(yololfile+".map", content, 0700)
+	exitOnError(err, "writing source-map")
+}
+
+// compileWithOptimizations compiles the given file using the given optimizations
+// if the compilation failed completely, the chips of the result are nil
+func compileWithOptimizations(fpath string, optimizations []string) (*compilation, error) {
+	converter := nolol.NewConverter()
+	converter.Debug(debugLog)
+	converter.SetIncludePaths(compileIncludePaths)
+	converter.SetRelease(compileRelease)
+	err := converter.SetOptimizations(optimizations)
+	exitOnError(err, "selecting optimizations")
+	err = converter.SetOptimizationLevel(compileLevel)
+	exitOnError(err, "selecting optimization-level")
+	for _, definition := range compileDefinitions {
+		def, err := nolol.ParseDefinition(definition)
+		exitOnError(err, "parsing definition")
+		converter.Define(def.Name, def.Value)
+	}
+	chips, compileerr := converter.ConvertChipsFile(fpath)
+	if chips == nil {
+		return &compilation{
+			explanations: converter.GetExplanations(),
+		}, compileerr
+	}
+
+	gen := parser.Printer{}
+	gen.Mode = parser.PrintermodeCompact
+	result := &compilation{
+		chips:        make([]string, len(chips)),
+		sourcemaps:   make([]*nolol.SourceMap, len(chips)),
+		warnings:     converter.GetWarnings(),
+		explanations: converter.GetExplanations(),
+	}
+	for i, chip := range chips {
+		result.chips[i], result.sourcemaps[i], err = converter.GenerateSourceMap(&gen, chip)
+		exitOnError(err, "generating code")
+	}
+	return result, compileerr
+}
+
+// printCompilationReport prints how much each optimization contributed to the generated code.
+// The optimizations of the nolol-compiler are intertwined with the conversion,
+// so the savings of a pass are determined by compiling the file again without it
+func printCompilationReport(fpath string, generated []string) {
+	report := make(optimizers.Report, 0, len(optimizationPasses))
+	for i, pass := range optimizationPasses {
+		others := make([]string, 0, len(optimizationPasses)-1)
+		others = append(others, optimizationPasses[:i]...)
+		others = append(others, optimizationPasses[i+1:]...)
+		without, _ := compileWithOptimizations(fpath, others)
+		if without.chips == nil {
+			fmt.Printf("The program can not be compiled without the optimization '%s'\n", pass)
+			continue
+		}
+		report = append(report, optimizers.CompareCode(pass, strings.Join(without.chips, ""), strings.Join(generated, "")))
+	}
+	fmt.Print(report)
+}
+
+// printExplanation prints every generated line together with the nolol-lines it has been created from
+// and the reason why the following line has not been merged into it
+func printExplanation(result *compilation) {
+	for i, explanation := range result.explanations {
+		if len(result.explanations) > 1 {
+			fmt.Printf("Chip %d:\n", i+1)
+		}
+		var code []string
+		if result.chips != nil {
+			code = strings.Split(result.chips[i], "\n")
+		}
+		for j, line := range explanation.Lines {
+			if j < len(code) {
+				fmt.Printf("%3d (%d characters): %s\n", j+1, len(code[j]), code[j])
+			} else {
+				fmt.Printf("%3d (about %d characters)\n", j+1, line.Length+explanation.LineCounterLength)
+			}
+			fmt.Printf("      from: %s\n", describeSources(line.Sources))
+			if line.Reason != "" {
+				fmt.Printf("      not merged with the next line: %s\n", line.Reason)
+			}
+		}
+		if explanation.LineCounterLength > 0 {
+			fmt.Printf("Time-tracking adds %d characters to every line (%d in total). %d characters are left for the statements of a line\n",
+				explanation.LineCounterLength, explanation.LineCounterLength*len(explanation.Lines), explanation.MaxLineLength)
+		}
+	}
+}
+
+// describeSources returns a short description of the given nolol-locations (file:line, line, ...)
+func describeSources(sources []ast.Position) string {
+	parts := []string{}
+	seen := make(map[string]bool)
+	lastFile := ""
+	for _, source := range sources {
+		if source.Line == 0 {
+			continue
+		}
+		part := strconv.Itoa(source.Line)
+		if source.File != lastFile {
+			part = source.File + ":" + part
+			lastFile = source.File
+		}
+		key := source.File + ":" + strconv.Itoa(source.Line)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "generated by the compiler"
+	}
+	return strings.Join(parts, ", ")
+}
+
 func init() {
 	rootCmd.AddCommand(compileCmd)
 	compileCmd.Flags().StringVarP(&outputFile, "out", "o", "<inputfile>.out", "The output file")
 	compileCmd.Flags().BoolVarP(&debugLog, "debug", "d", false, "Print debug logs while parsing")
+	compileCmd.Flags().StringSliceVar(&optimizationPasses, "optimizations", optimizers.PassNames(), "The optimizations to perform")
+	compileCmd.Flags().StringVarP(&compileLevel, "level", "O", nolol.OptimizeSize, "The optimization-level. -O0: readable code for debugging (no optimizations, one yolol-line per nolol-line), -Os: smallest code, -Ofast: fewest executed lines")
+	compileCmd.Flags().StringArrayVarP(&compileDefinitions, "define", "D", []string{}, "Define a constant (name=value). Overrides definitions with the same name in the code")
+	compileCmd.Flags().StringArrayVarP(&compileIncludePaths, "include", "I", []string{}, "Add a directory to search for included files (if they are not found relative to the including file)")
+	compileCmd.Flags().BoolVar(&compileSourceMap, "sourcemap", false, "Write a source-map (<outputfile>.map) that maps the generated yolol-code to the nolol-source")
+	compileCmd.Flags().BoolVar(&compileRelease, "release", false, "Remove assertions and debug-blocks from the generated code")
+	compileCmd.Flags().BoolVar(&compileExplain, "explain", false, "Print every generated line together with the nolol-lines it has been created from and why the next line has not been merged into it")
+	compileCmd.Flags().BoolVar(&optimizationReport, "report", false, "Print how many characters and lines each optimization saved and which lines it changed")
 }
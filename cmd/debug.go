@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/debug"
+	"github.com/dbaumgarten/yodk/pkg/nolol"
 
 	"github.com/abiosoft/ishell"
 	"github.com/dbaumgarten/yodk/pkg/vm"
@@ -86,8 +87,15 @@ func prepareVM(thisVM *vm.VM, inputFileName string) {
 		return false
 	})
 	thisVM.SetErrorHandler(func(x *vm.VM, err error) bool {
-		debugShell.Printf("--A runtime error occured at %s:%d--\n", inputFileName, x.CurrentSourceLine())
-		debugShell.Println(err)
+		if assertion, isassertion := nolol.AssertionFailure(x, err).(*nolol.AssertionError); isassertion {
+			debugShell.Printf("--An assertion failed at %s:%d--\n", inputFileName, assertion.Position.Line)
+			if assertion.Message != "" {
+				debugShell.Println(assertion.Message)
+			}
+		} else {
+			debugShell.Printf("--A runtime error occured at %s:%d--\n", inputFileName, x.CurrentSourceLine())
+			debugShell.Println(err)
+		}
 		debugShell.Println("--Execution paused--")
 		return false
 	})
@@ -315,6 +323,11 @@ func init() {
 				}
 				pfx += fmt.Sprintf("%3d ", i+1)
 				debugShell.Println(pfx + line)
+				if sourcemap, exists := helper.SourceMaps[helper.CurrentScript]; exists {
+					for _, mapping := range sourcemap.Lookup(i+1, 0) {
+						debugShell.Println("      " + formatMapping(mapping))
+					}
+				}
 			}
 		},
 	})
@@ -339,11 +352,26 @@ func init() {
 				}
 				pfx += fmt.Sprintf("%3d ", i+1)
 				debugShell.Println(pfx + line)
+				if sourcemap, exists := helper.SourceMaps[helper.CurrentScript]; exists {
+					for _, mapping := range sourcemap.Lookup(i+1, 0) {
+						debugShell.Println("      " + formatMapping(mapping))
+					}
+				}
 			}
 		},
 	})
 }
 
+// formatMapping returns a human-readable description of the source-location of a mapping
+func formatMapping(mapping nolol.Mapping) string {
+	txt := fmt.Sprintf("[%d-%d] %s:%d:%d", mapping.StartColumn, mapping.EndColumn-1, mapping.Source, mapping.SourceLine, mapping.SourceColumn)
+	for i := len(mapping.Expansions) - 1; i >= 0; i-- {
+		exp := mapping.Expansions[i]
+		txt += fmt.Sprintf(" <- %s (%s:%d:%d)", exp.Macro, exp.Source, exp.Line, exp.Column)
+	}
+	return txt
+}
+
 type namedVariable struct {
 	name string
 	val  vm.Variable
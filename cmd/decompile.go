@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+// if true, existing nolol-files are overwritten
+var decompileOverwrite bool
+
+// decompileCmd represents the decompile command
+var decompileCmd = &cobra.Command{
+	Use:   "decompile [file]+",
+	Short: "Convert yolol programms to nolol",
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, file := range args {
+			fmt.Println("Decompiling file:", file)
+			decompileFile(file)
+		}
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+func decompileFile(fpath string) {
+	if !strings.HasSuffix(fpath, ".yolol") {
+		exitOnError(fmt.Errorf("Only yolol-files can be decompiled"), "opening file")
+	}
+	outfile := strings.Replace(fpath, path.Ext(fpath), ".nolol", -1)
+	if _, err := os.Stat(outfile); err == nil && !decompileOverwrite {
+		exitOnError(fmt.Errorf("The file '%s' already exists. Use --overwrite to replace it", outfile), "writing file")
+	}
+
+	file := loadInputFile(fpath)
+	p := parser.NewParser()
+	parsed, errs := p.Parse(file)
+	if errs != nil {
+		exitOnError(errs, "parsing file")
+	}
+
+	decompiled, err := nolol.NewDecompiler().Decompile(parsed)
+	exitOnError(err, "decompiling")
+
+	printer := nolol.NewPrinter()
+	generated, err := printer.Print(decompiled)
+	exitOnError(err, "generating code")
+
+	err = ioutil.WriteFile(outfile, []byte(generated), 0700)
+	exitOnError(err, "writing file")
+}
+
+func init() {
+	rootCmd.AddCommand(decompileCmd)
+	decompileCmd.Flags().BoolVar(&decompileOverwrite, "overwrite", false, "Overwrite existing nolol-files")
+}
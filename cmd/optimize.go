@@ -12,6 +12,15 @@ import (
 )
 
 var outputFile string
+var verifyOptimization bool
+var verifyIterations int
+var verifyInputs int
+
+// the optimizations to perform. Shared by optimize and compile
+var optimizationPasses []string
+
+// if true, print a report about what each optimization changed
+var optimizationReport bool
 
 // optimizeCmd represents the compile command
 var optimizeCmd = &cobra.Command{
@@ -36,9 +45,29 @@ func optimize(filepath string) {
 	if errs != nil {
 		exitOnError(errs, "parsing file")
 	}
-	opt := optimizers.NewCompoundOptimizer()
-	err := opt.Optimize(parsed)
-	exitOnError(err, "performing optimisation")
+	opt, err := optimizers.NewCompoundOptimizerWithPasses(optimizationPasses)
+	exitOnError(err, "selecting optimizations")
+	if verifyOptimization {
+		verifier := optimizers.NewVerifier()
+		verifier.Iterations = verifyIterations
+		verifier.RandomInputs = verifyInputs
+		verified, err := verifier.Verify(file, opt.Passes())
+		exitOnError(err, "verifying optimisation")
+		if optimizationReport {
+			// the optimizations are deterministic. Optimizing the program again produces the same result as the verified one
+			report, err := opt.OptimizeWithReport(parsed)
+			exitOnError(err, "performing optimisation")
+			fmt.Print(report)
+		}
+		parsed = verified
+	} else if optimizationReport {
+		report, err := opt.OptimizeWithReport(parsed)
+		exitOnError(err, "performing optimisation")
+		fmt.Print(report)
+	} else {
+		err = opt.Optimize(parsed)
+		exitOnError(err, "performing optimisation")
+	}
 	gen := parser.Printer{}
 	gen.Mode = parser.PrintermodeCompact
 	generated, err := gen.Print(parsed)
@@ -49,4 +78,9 @@ func optimize(filepath string) {
 func init() {
 	rootCmd.AddCommand(optimizeCmd)
 	optimizeCmd.Flags().StringVarP(&outputFile, "out", "o", "<inputfile>.out", "The output file")
+	optimizeCmd.Flags().StringSliceVar(&optimizationPasses, "optimizations", optimizers.PassNames(), "The optimizations to perform, in the order they are performed")
+	optimizeCmd.Flags().BoolVar(&optimizationReport, "report", false, "Print how many characters and lines each optimization saved and which lines it changed")
+	optimizeCmd.Flags().BoolVar(&verifyOptimization, "verify", false, "Run the original and the optimized program with random inputs and make sure both behave the same")
+	optimizeCmd.Flags().IntVar(&verifyIterations, "verify-iterations", 10, "How often the programs are run for every input when verifying")
+	optimizeCmd.Flags().IntVar(&verifyInputs, "verify-inputs", 200, "The number of random inputs to use when verifying")
 }
@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dbaumgarten/yodk/pkg/nolol"
 	"github.com/dbaumgarten/yodk/pkg/vm"
 	"github.com/google/go-dap"
 )
@@ -156,10 +157,18 @@ func (h *YODKHandler) configureVM(yvm *vm.VM, filename string) {
 		return false
 	})
 	yvm.SetErrorHandler(func(x *vm.VM, err error) bool {
+		description := "A runtim-error occured"
+		if assertion, isassertion := nolol.AssertionFailure(x, err).(*nolol.AssertionError); isassertion {
+			if assertion.Position.File == "" {
+				assertion.Position.File = filename
+			}
+			description = "An assertion failed"
+			err = assertion
+		}
 		h.session.SendEvent(&dap.StoppedEvent{
 			Body: dap.StoppedEventBody{
 				Reason:      "exception",
-				Description: "A runtim-error occured",
+				Description: description,
 				ThreadId:    h.helper.ScriptIndexByName(filename) + 1,
 				Text:        err.Error(),
 			},
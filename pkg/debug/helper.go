@@ -41,6 +41,8 @@ type Helper struct {
 	ValidBreakpoints map[int]map[int]bool
 	// CompiledCode contains the generated yolol-code for for VMs that are running NOLOL
 	CompiledCode map[int]string
+	// SourceMaps contains the source-maps for the CompiledCode (if available)
+	SourceMaps map[int]*nolol.SourceMap
 }
 
 // JoinPath wraps filepath.Join, but returns only the second part if the second part is an absolute path
@@ -106,6 +108,7 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 		FinishedVMs:          make(map[int]bool),
 		ValidBreakpoints:     make(map[int]map[int]bool),
 		CompiledCode:         make(map[int]string),
+		SourceMaps:           make(map[int]*nolol.SourceMap),
 	}
 
 	for i, inputFileName := range h.ScriptNames {
@@ -134,8 +137,9 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 			pri := parser.Printer{
 				Mode: parser.PrintermodeReadable,
 			}
-			yololcodestr, _ := pri.Print(yololcode)
+			yololcodestr, sourcemap, _ := converter.GenerateSourceMap(&pri, yololcode)
 			h.CompiledCode[i] = yololcodestr
+			h.SourceMaps[i] = sourcemap
 			thisVM = vm.Create(yololcode)
 		} else {
 			return nil, fmt.Errorf("Invalid file extension on: %s", inputFileName)
@@ -174,6 +178,7 @@ func FromTest(workspace string, testfile string, casenr int, prepareVM VMPrepare
 		FinishedVMs:          make(map[int]bool),
 		ValidBreakpoints:     make(map[int]map[int]bool),
 		CompiledCode:         make(map[int]string),
+		SourceMaps:           make(map[int]*nolol.SourceMap),
 	}
 
 	for i, script := range t.Scripts {
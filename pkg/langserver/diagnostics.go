@@ -60,6 +60,7 @@ func (s *LangServer) Diagnose(ctx context.Context, uri lsp.DocumentURI) {
 	go func() {
 		var errs error
 		var parsed *ast.Program
+		var warnings parser.Errors
 		text, _ := s.cache.Get(uri)
 
 		if strings.HasSuffix(string(uri), ".yolol") {
@@ -67,8 +68,13 @@ func (s *LangServer) Diagnose(ctx context.Context, uri lsp.DocumentURI) {
 			parsed, errs = p.Parse(text)
 		} else if strings.HasSuffix(string(uri), ".nolol") {
 			conv := nolol.NewConverter()
+			// invalid settings are ignored. The converter then keeps using all optimizations (at the default-level)
+			conv.SetOptimizations(s.settings.Yolol.Optimization.Passes)
+			conv.SetOptimizationLevel(s.settings.Yolol.Optimization.Level)
+			conv.SetIncludePaths(s.settings.Yolol.Nolol.IncludePaths)
 			mainfile := string(uri)
-			_, errs = conv.ConvertFileEx(mainfile, newfs(s, uri))
+			_, errs = conv.ConvertChipsFileEx(mainfile, newfs(s, uri))
+			warnings = conv.GetWarnings()
 		} else {
 			return
 		}
@@ -110,6 +116,29 @@ func (s *LangServer) Diagnose(ctx context.Context, uri lsp.DocumentURI) {
 			diags = append(diags, diag)
 		}
 
+		for _, warning := range warnings {
+			// warnings for included files can not be shown in this file
+			if warning.StartPosition.File != "" {
+				continue
+			}
+			diag := lsp.Diagnostic{
+				Source:   "nolol",
+				Message:  warning.Message,
+				Severity: lsp.SeverityWarning,
+				Range: lsp.Range{
+					Start: lsp.Position{
+						Line:      float64(warning.StartPosition.Line) - 1,
+						Character: float64(warning.StartPosition.Coloumn) - 1,
+					},
+					End: lsp.Position{
+						Line:      float64(warning.EndPosition.Line) - 1,
+						Character: float64(warning.EndPosition.Coloumn) - 1,
+					},
+				},
+			}
+			diags = append(diags, diag)
+		}
+
 		// check if the code-length of yolol-code is OK
 		if len(diags) == 0 && s.settings.Yolol.LengthChecking.Mode != LengthCheckModeOff && strings.HasSuffix(string(uri), ".yolol") {
 			lengtherror := validators.ValidateCodeLength(text)
@@ -117,8 +146,11 @@ func (s *LangServer) Diagnose(ctx context.Context, uri lsp.DocumentURI) {
 			// check if the code is small enough after optimizing it
 			if lengtherror != nil && s.settings.Yolol.LengthChecking.Mode == LengthCheckModeOptimize && parsed != nil {
 
-				opt := optimizers.NewCompoundOptimizer()
-				err := opt.Optimize(parsed)
+				opt, err := optimizers.NewCompoundOptimizerWithPasses(s.settings.Yolol.Optimization.Passes)
+				if err != nil {
+					opt = optimizers.NewCompoundOptimizer()
+				}
+				err = opt.Optimize(parsed)
 				if err == nil {
 					printer := parser.Printer{
 						Mode: parser.PrintermodeCompact,
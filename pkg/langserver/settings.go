@@ -2,6 +2,9 @@ package langserver
 
 import (
 	"encoding/json"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/optimizers"
 )
 
 const (
@@ -19,8 +22,15 @@ type Settings struct {
 
 // YololSettings contains settings specific to yolol
 type YololSettings struct {
-	Formatting     FormatSettings      `json:"formatting"`
-	LengthChecking LengthCheckSettings `json:"lengthChecking"`
+	Formatting     FormatSettings       `json:"formatting"`
+	LengthChecking LengthCheckSettings  `json:"lengthChecking"`
+	Optimization   OptimizationSettings `json:"optimization"`
+	Nolol          NololSettings        `json:"nolol"`
+}
+
+// NololSettings contains settings for compiling nolol
+type NololSettings struct {
+	IncludePaths []string `json:"includePaths"`
 }
 
 // FormatSettings contains formatting settings
@@ -33,6 +43,13 @@ type LengthCheckSettings struct {
 	Mode string `json:"mode"`
 }
 
+// OptimizationSettings contains settings for the optimizers used when checking code-length and compiling nolol
+type OptimizationSettings struct {
+	Passes []string `json:"passes"`
+	// the optimization-level used when compiling nolol (0, s or fast)
+	Level string `json:"level"`
+}
+
 func (s *Settings) Read(inp interface{}) error {
 	by, err := json.Marshal(inp)
 	if err != nil {
@@ -51,6 +68,13 @@ func DefaultSettings() *Settings {
 			LengthChecking: LengthCheckSettings{
 				Mode: LengthCheckModeStrict,
 			},
+			Optimization: OptimizationSettings{
+				Passes: optimizers.PassNames(),
+				Level:  nolol.OptimizeSize,
+			},
+			Nolol: NololSettings{
+				IncludePaths: []string{},
+			},
 		},
 	}
 }
@@ -3,7 +3,8 @@ package nolol
 import (
 	"fmt"
 	"path/filepath"
-	"strconv"
+	"sort"
+	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
 	"github.com/dbaumgarten/yodk/pkg/optimizers"
@@ -17,41 +18,182 @@ type Converter struct {
 	jumpLabels map[string]int
 	// the names of definitions are case-insensitive. Keys are converted to lowercase before using them
 	// all lookups MUST also use lowercased keys
-	definitions      map[string]ast.Expression
+	definitions map[string]ast.Expression
+	// describes how the lines of every chip have been merged
+	explanations []*Explanation
+	// definitions that have been supplied from the outside. They override the definitions in the code
+	// keys are lowercase
+	overrides        map[string]ast.Expression
 	usesTimeTracking bool
 	iflabelcounter   int
 	waitlabelcounter int
 	loopcounter      int
+	switchcounter    int
 	// keeps track of the current loop we are in while converting
 	// the last element in the list is the current innermost loop
-	loopLevel           []int
-	sexpOptimizer       *optimizers.StaticExpressionOptimizer
-	boolexpOptimizer    *optimizers.ExpressionInversionOptimizer
-	varnameOptimizer    *optimizers.VariableNameOptimizer
-	includecount        int
-	macros              map[string]*nast.MacroDefinition
-	macroLevel          []string
-	macroInsertionCount int
-	debug               bool
+	loopLevel        []loopScope
+	sexpOptimizer    *optimizers.StaticExpressionOptimizer
+	algOptimizer     *optimizers.AlgebraicOptimizer
+	boolexpOptimizer *optimizers.ExpressionInversionOptimizer
+	varnameOptimizer *optimizers.VariableNameOptimizer
+	includecount     int
+	// directories that are searched for included files
+	includePaths []string
+	macros       map[string]*nast.MacroDefinition
+	// the declared arrays. Keys are lowercase
+	arrays       map[string]*arrayDefinition
+	arraycounter int
+	macroLevel   []string
+	// the scopes of the expression-macros a call has been inserted by
+	callScopes map[*nast.FuncCall][]string
+	debug      bool
+	// if true, assertions and debug-blocks are removed
+	release bool
+	// the names of the enabled optimization-passes
+	optimizations map[string]bool
+	// the optimization-level (see OptimizationLevels())
+	level string
+	// original names of the variables, if variable names are not shortened
+	variableTranslations map[string]string
+	// the macro-insertions that are currently being converted. The last element is the innermost insertion
+	expansions []MacroExpansion
+	// the macro-insertions the nodes inside of macros have been inserted by
+	nodeExpansions map[ast.Node][]MacroExpansion
+	// the name of the converted main-file (if known)
+	mainfile string
+	// non-fatal problems found during conversion
+	warnings parser.Errors
+	// lowercased names of the macros that have been inserted at least once
+	usedMacros map[string]bool
+	// labels and (lowercased) local variables that are used in the main-file outside of macros
+	programLabels    map[string]bool
+	programVariables map[string]bool
+	// the position of the definition that currently defines a name. Keys are lowercase
+	definitionPositions map[string]ast.Position
 }
 
 // NewConverter creates a new converter
 func NewConverter() *Converter {
-	return &Converter{
-		jumpLabels:       make(map[string]int),
-		definitions:      make(map[string]ast.Expression),
-		macros:           make(map[string]*nast.MacroDefinition),
-		macroLevel:       make([]string, 0),
-		sexpOptimizer:    optimizers.NewStaticExpressionOptimizer(),
-		boolexpOptimizer: &optimizers.ExpressionInversionOptimizer{},
-		varnameOptimizer: optimizers.NewVariableNameOptimizer(),
-		loopLevel:        make([]int, 0),
+	c := &Converter{
+		jumpLabels:           make(map[string]int),
+		definitions:          make(map[string]ast.Expression),
+		overrides:            make(map[string]ast.Expression),
+		macros:               make(map[string]*nast.MacroDefinition),
+		arrays:               make(map[string]*arrayDefinition),
+		macroLevel:           make([]string, 0),
+		sexpOptimizer:        optimizers.NewStaticExpressionOptimizer(),
+		algOptimizer:         optimizers.NewAlgebraicOptimizer(),
+		boolexpOptimizer:     &optimizers.ExpressionInversionOptimizer{},
+		varnameOptimizer:     optimizers.NewVariableNameOptimizer(),
+		loopLevel:            make([]loopScope, 0),
+		variableTranslations: make(map[string]string),
+		expansions:           make([]MacroExpansion, 0),
+		nodeExpansions:       make(map[ast.Node][]MacroExpansion),
+		callScopes:           make(map[*nast.FuncCall][]string),
+		warnings:             make(parser.Errors, 0),
+		usedMacros:           make(map[string]bool),
+		programLabels:        make(map[string]bool),
+		programVariables:     make(map[string]bool),
+		definitionPositions:  make(map[string]ast.Position),
 	}
+	c.SetOptimizations(optimizers.PassNames())
+	c.level = OptimizeSize
+	return c
+}
+
+// SetOptimizations selects the optimizations to perform during conversion. See optimizers.PassNames() for possible values.
+// The order of the passes has no effect and as comments are never copied to the output, the "comments"-pass changes nothing.
+// By default all optimizations are enabled. At optimization-level 0, none of them is performed (see SetOptimizationLevel).
+func (c *Converter) SetOptimizations(passes []string) error {
+	err := optimizers.ValidatePasses(passes)
+	if err != nil {
+		return err
+	}
+	c.optimizations = make(map[string]bool)
+	for _, pass := range passes {
+		c.optimizations[pass] = true
+	}
+	return nil
+}
+
+// The optimization-levels of the converter
+const (
+	// OptimizeNone generates readable code for debugging. Variables keep their names, no optimization-passes are performed
+	// and every nolol-line is placed on its own yolol-line
+	OptimizeNone = "0"
+	// OptimizeSize generates code that is as small as possible. This is the default
+	OptimizeSize = "s"
+	// OptimizeSpeed generates code that executes as few lines as possible, even if this makes the code larger.
+	// For example, the conditions of while-loops are duplicated to the end of the loop, instead of jumping back to the check at the beginning
+	OptimizeSpeed = "fast"
+)
+
+// OptimizationLevels returns the names of all available optimization-levels
+func OptimizationLevels() []string {
+	return []string{OptimizeNone, OptimizeSize, OptimizeSpeed}
+}
+
+// ParseOptimizationLevel returns the optimization-level with the given name.
+// The name can be given with or without the prefix of the command-line flag (-O0, O0 or 0). An empty name selects the default-level
+func ParseOptimizationLevel(name string) (string, error) {
+	level := strings.TrimPrefix(strings.TrimPrefix(name, "-"), "O")
+	if level == "" {
+		return OptimizeSize, nil
+	}
+	for _, known := range OptimizationLevels() {
+		if level == known {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown optimization-level '%s'. Available levels are: -O%s", name, strings.Join(OptimizationLevels(), ", -O"))
+}
+
+// SetOptimizationLevel selects the trade-off between readability, size and speed of the generated code. See ParseOptimizationLevel() for possible values.
+// At level 0, no optimization-passes are performed, regardless of SetOptimizations().
+// At the other levels, the passes selected by SetOptimizations() are performed
+func (c *Converter) SetOptimizationLevel(name string) error {
+	level, err := ParseOptimizationLevel(name)
+	if err != nil {
+		return err
+	}
+	c.level = level
+	return nil
+}
+
+// optimize checks if the given optimization-pass should be performed
+func (c *Converter) optimize(pass string) bool {
+	return c.level != OptimizeNone && c.optimizations[pass]
+}
+
+// variableName returns the name to use for the given variable in the generated code
+func (c *Converter) variableName(name string) string {
+	if c.optimize("varnames") {
+		return c.varnameOptimizer.OptimizeVarName(name)
+	}
+	// internal variables start with an underscore, which is not allowed in yolol
+	if strings.HasPrefix(name, "_") {
+		name = "nolol" + name
+	}
+	if !strings.HasPrefix(name, ":") {
+		c.variableTranslations[strings.ToLower(name)] = name
+	}
+	return name
+}
+
+// optimizeInversion tries to remove the "not" of a negated expression, if the inversion-optimization is enabled
+func (c *Converter) optimizeInversion(exp ast.Expression) ast.Expression {
+	if !c.optimize("inversion") {
+		return exp
+	}
+	return c.boolexpOptimizer.OptimizeExpression(exp)
 }
 
 // GetVariableTranslations returns a table that can be used to find the original names
 // of the variables whos names where shortened during conversion
 func (c *Converter) GetVariableTranslations() map[string]string {
+	if !c.optimize("varnames") {
+		return c.variableTranslations
+	}
 	return c.varnameOptimizer.GetReversalTable()
 }
 
@@ -68,6 +210,7 @@ func (c *Converter) ConvertFile(mainfile string) (*ast.Program, error) {
 // ConvertFileEx acts like ConvertFile, but allows the passing of a custom filesystem from which the source files
 // are retrieved. This way, files that are not stored on disk can be converted
 func (c *Converter) ConvertFileEx(mainfile string, files FileSystem) (*ast.Program, error) {
+	c.mainfile = mainfile
 	file, err := files.Get(mainfile)
 	if err != nil {
 		return nil, err
@@ -89,47 +232,95 @@ func (c *Converter) Debug(b bool) {
 // Convert converts a nolol-program to a yolol-program
 // files is an object to access files that are referenced in prog's include directives
 func (c *Converter) Convert(prog *nast.Program, files FileSystem) (*ast.Program, error) {
+	chips, err := c.ConvertChips(prog, files)
+	if len(chips) > 1 {
+		return nil, &parser.Error{
+			Message:       "The program is split into multiple chips (using #chip) and can not be converted into a single yolol-program",
+			StartPosition: ast.NewPosition("", 1, 1),
+			EndPosition:   ast.NewPosition("", 1, 1),
+		}
+	}
+	if len(chips) == 0 {
+		return nil, err
+	}
+	return chips[0], err
+}
+
+// preprocess converts all nolol-specific elements of the program into statement-lines (and chip-boundaries)
+func (c *Converter) preprocess(prog *nast.Program, files FileSystem) error {
 	c.files = files
 
+	err := c.resolveLocals(prog, localPrefix)
+	if err != nil {
+		return err
+	}
+
 	c.usesTimeTracking = usesTimeTracking(prog)
 	// reserve a name for use in time-tracking
-	c.varnameOptimizer.OptimizeVarName(reservedTimeVariable)
+	c.variableName(reservedTimeVariable)
 
-	err := c.convertNodes(prog)
+	c.findProgramScope(prog)
+
+	err = c.convertNodes(prog)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
+	c.warnUnused(prog)
+
 	err = c.resolveGotoChains(prog)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = c.removeUnusedLabels(prog)
-	if err != nil {
-		return nil, err
+	return c.removeUnusedLabels(prog)
+}
+
+// mergeLines merges the statement-lines of the program as good as possible and computes the line-numbers of all labels
+func (c *Converter) mergeLines(prog *nast.Program) error {
+	explanation := &Explanation{
+		Lines:         []*LineExplanation{},
+		MaxLineLength: c.maxLineLength(),
 	}
+	c.explanations = append(c.explanations, explanation)
 
-	// merge the statemens of the program as good as possible
-	merged, err := c.mergeNololElements(prog.Elements)
+	merged, err := c.mergeNololElements(prog.Elements, explanation)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	prog.Elements = merged
 
 	err = c.removeDuplicateGotos(prog)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// find all line-labels
 	err = c.findJumpLabels(prog)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
+	// empty lines have been removed while searching for labels
+	remaining := make(map[nast.Element]bool, len(prog.Elements))
+	for _, element := range prog.Elements {
+		remaining[element] = true
+	}
+	lines := make([]*LineExplanation, 0, len(prog.Elements))
+	for i, element := range merged {
+		if remaining[element] {
+			lines = append(lines, explanation.Lines[i])
+		}
+	}
+	explanation.Lines = lines
+
+	return c.pinLines(prog, explanation)
+}
+
+// toYolol converts a program that consists only of merged statement-lines to yolol
+func (c *Converter) toYolol(prog *nast.Program) (*ast.Program, error) {
 	// resolve jump-labels
-	err = c.replaceGotoLabels(prog)
+	err := c.replaceGotoLabels(prog)
 	if err != nil {
 		return nil, err
 	}
@@ -143,17 +334,29 @@ func (c *Converter) Convert(prog *nast.Program, files FileSystem) (*ast.Program,
 		Lines: make([]*ast.Line, len(prog.Elements)),
 	}
 
+	// lines of yolol-blocks must not be optimized
+	optimizable := make([]*ast.Line, 0, len(prog.Elements))
 	for i, element := range prog.Elements {
 		line := element.(*nast.StatementLine)
 		out.Lines[i] = &ast.Line{
 			Position:   line.Position,
 			Statements: line.Statements,
 		}
+		if !line.Raw {
+			optimizable = append(optimizable, out.Lines[i])
+		}
+	}
+
+	if c.optimize("ifexpressions") {
+		err = optimizers.NewIfExpressionOptimizer().OptimizeLines(out, optimizable)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if len(out.Lines) > 20 {
 		return out, &parser.Error{
-			Message: "Program is too large to be compiled into 20 lines of yolol.",
+			Message: "Program is too large to be compiled into 20 lines of yolol. Use #chip to split it across multiple chips.",
 			StartPosition: ast.Position{
 				Line:    1,
 				Coloumn: 1,
@@ -168,11 +371,116 @@ func (c *Converter) Convert(prog *nast.Program, files FileSystem) (*ast.Program,
 	return out, nil
 }
 
-func (c *Converter) maxLineLength() int {
-	if !c.usesTimeTracking {
-		return 70
+// renameByUsage gives the shortest variable-names to the most used variables.
+// During conversion, the names are assigned in the order the variables are encountered.
+// Afterwards the uses are counted in the generated code (over all chips) and the assigned names are redistributed.
+// If this would make any line too long, the names are kept as they are
+func (c *Converter) renameByUsage(chips []*ast.Program) {
+	if !c.optimize("varnames") {
+		return
+	}
+	combined := &ast.Program{
+		Lines: []*ast.Line{},
+	}
+	for _, chip := range chips {
+		combined.Lines = append(combined.Lines, chip.Lines...)
+	}
+	translations := c.varnameOptimizer.GetReversalTable()
+	used := make([]string, 0)
+	for _, name := range optimizers.VariablesByUsage(combined) {
+		// variables that have not been renamed by the compiler keep their name
+		if _, exists := translations[strings.ToLower(name)]; exists {
+			used = append(used, strings.ToLower(name))
+		}
+	}
+	// the unused names (like the reserved name for time-tracking) are moved to the end
+	isUsed := make(map[string]bool, len(used))
+	for _, name := range used {
+		isUsed[name] = true
+	}
+	available := make([]string, 0, len(translations))
+	for name := range translations {
+		available = append(available, name)
 	}
-	return 70 - 4
+	// shorter names were generated first
+	sort.Slice(available, func(i, j int) bool {
+		if len(available[i]) != len(available[j]) {
+			return len(available[i]) < len(available[j])
+		}
+		return available[i] < available[j]
+	})
+	for _, name := range available {
+		if !isUsed[name] {
+			used = append(used, name)
+		}
+	}
+
+	renames := make(map[string]string)
+	inverted := make(map[string]string)
+	for i, name := range used {
+		if name != available[i] {
+			renames[name] = available[i]
+			inverted[available[i]] = name
+		}
+	}
+	if len(renames) == 0 {
+		return
+	}
+
+	rename := func(mapping map[string]string) {
+		combined.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			switch n := node.(type) {
+			case *ast.Assignment:
+				if newName, exists := mapping[strings.ToLower(n.Variable)]; exists && visitType == ast.PreVisit {
+					n.Variable = newName
+				}
+			case *ast.Dereference:
+				if newName, exists := mapping[strings.ToLower(n.Variable)]; exists {
+					n.Variable = newName
+				}
+			}
+			return nil
+		}))
+	}
+
+	rename(renames)
+	for _, line := range combined.Lines {
+		if getLengthOfLine(line) > 70 {
+			rename(inverted)
+			return
+		}
+	}
+	c.varnameOptimizer.Rename(renames)
+}
+
+// estimateDynamicGotos returns a copy of node where all dynamic gotos are replaced by the longest code they could be converted to.
+// The line-numbers of the labels are not known until all lines have been merged, so two-digit line-numbers are assumed.
+// If node contains no dynamic gotos, it is returned unchanged
+func estimateDynamicGotos(node ast.Node) ast.Node {
+	found := false
+	node.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if _, is := node.(*nast.DynamicGoToStatement); is {
+			found = true
+		}
+		return nil
+	}))
+	if !found {
+		return node
+	}
+	node = nast.CopyAst(node)
+	node.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if gotostmt, is := node.(*nast.DynamicGoToStatement); is && visitType == ast.PreVisit {
+			lines := make([]int, len(gotostmt.Labels))
+			lines[0] = 99
+			return ast.NewNodeReplacementSkip(dynamicGotoToYolol(gotostmt, lines))
+		}
+		return nil
+	}))
+	return node
+}
+
+func (c *Converter) maxLineLength() int {
+	return 70 - c.lineCounterLength()
 }
 
 func (c *Converter) convertNodes(node ast.Node) error {
@@ -194,7 +502,13 @@ func (c *Converter) convertNodes(node ast.Node) error {
 			}
 		case *nast.MacroInsetion:
 			if visitType == ast.PreVisit {
-				c.macroLevel = append(c.macroLevel, n.Function+":"+strconv.Itoa(n.Start().Line))
+				c.macroLevel = append(c.macroLevel, c.insertionScope(n.FuncCall))
+				c.expansions = append(c.expansions, MacroExpansion{
+					Macro:  n.Function,
+					Source: c.sourceName(n.Start()),
+					Line:   n.Start().Line,
+					Column: n.Start().Coloumn,
+				})
 				return c.convertMacroInsertion(n)
 			}
 		case *nast.IncludeDirective:
@@ -203,8 +517,50 @@ func (c *Converter) convertNodes(node ast.Node) error {
 			if visitType == ast.PostVisit {
 				return c.convertWait(n)
 			}
-		case *nast.FuncCall:
+		case *nast.Sleep:
+			// the sleep is replaced by a wait, which is then converted as usual
+			if visitType == ast.PreVisit {
+				return c.convertSleep(n)
+			}
+		case *nast.StatementLine:
+			// macro-calls must be expanded, BEFORE the statements are processed
+			if visitType == ast.PreVisit {
+				err := c.hoistMacroCalls(n)
+				if err != nil {
+					return err
+				}
+				return c.hoistArrayAccesses(n)
+			}
+		case *nast.RawYololBlock:
+			if visitType == ast.PreVisit {
+				return c.convertRawYolol(n)
+			}
+		case *nast.Assertion:
+			// the condition must be checked, BEFORE it is converted
+			if visitType == ast.PreVisit {
+				return c.convertAssertion(n)
+			}
+		case *nast.DebugBlock:
+			if visitType == ast.PreVisit {
+				return c.convertDebugBlock(n)
+			}
+		case *nast.ArrayDeclaration:
+			// the bounds of the array must be known, BEFORE it is used
+			if visitType == ast.PreVisit {
+				return c.convertArrayDeclaration(n)
+			}
+		case *nast.ArrayAccess:
+			if visitType == ast.PostVisit {
+				return c.convertArrayAccess(n)
+			}
+		case *nast.ArrayAssignment:
 			if visitType == ast.PostVisit {
+				return c.convertArrayAssignment(n)
+			}
+		case *nast.FuncCall:
+			// using pre-visit here is important
+			// the arguments of macros must be inserted, BEFORE they are processed
+			if visitType == ast.PreVisit {
 				return c.convertFuncCall(n)
 			}
 		case *ast.Dereference:
@@ -213,30 +569,65 @@ func (c *Converter) convertNodes(node ast.Node) error {
 			if visitType == ast.PostVisit {
 				return c.convertIf(n)
 			}
+		case *nast.CompileTimeIf:
+			// the condition must be evaluated, BEFORE the contents of the blocks are processed
+			if visitType == ast.PreVisit {
+				return c.convertCompileTimeIf(n)
+			}
+		case *nast.ForLoop:
+			// the loop must be unrolled, BEFORE its contents are processed
+			if visitType == ast.PreVisit {
+				return c.convertForLoop(n)
+			}
+		case *nast.SwitchStatement:
+			if visitType == ast.PostVisit {
+				return c.convertSwitch(n)
+			}
 		case *nast.WhileLoop:
 			if visitType == ast.PreVisit {
-				c.loopcounter++
-				c.loopLevel = append(c.loopLevel, c.loopcounter)
+				c.enterWhileLoop(n)
 			}
 			if visitType == ast.PostVisit {
 				result := c.convertWhileLoop(n)
-				c.loopLevel = c.loopLevel[:len(c.loopLevel)-1]
+				c.leaveLoop()
+				return result
+			}
+		case *nast.DoWhileLoop:
+			if visitType == ast.PreVisit {
+				c.enterDoWhileLoop(n)
+			}
+			if visitType == ast.PostVisit {
+				result := c.convertDoWhileLoop(n)
+				c.leaveLoop()
 				return result
 			}
 		case *ast.UnaryOperation:
 		case *ast.BinaryOperation:
 			if visitType == ast.PostVisit {
-				repl := c.sexpOptimizer.OptimizeExpressionNonRecursive(n)
-				if repl != nil {
-					return ast.NewNodeReplacementSkip(repl)
+				if c.optimize("static") {
+					repl := c.sexpOptimizer.OptimizeExpressionNonRecursive(n)
+					if repl != nil {
+						return ast.NewNodeReplacementSkip(repl)
+					}
+				}
+				if c.optimize("algebraic") {
+					repl := c.algOptimizer.OptimizeExpressionNonRecursive(n)
+					if repl != nil {
+						return ast.NewNodeReplacementSkip(repl)
+					}
 				}
 				return nil
 			}
 		case *nast.Trigger:
 			if n.Kind == "macroleft" {
 				c.macroLevel = c.macroLevel[:len(c.macroLevel)-1]
+				c.expansions = c.expansions[:len(c.expansions)-1]
 				return ast.NewNodeReplacement()
 			}
+		case *nast.DynamicGoToStatement:
+			if visitType == ast.PostVisit {
+				return c.convertDynamicGoto(n)
+			}
 		case *nast.BreakStatement:
 			return c.convertBreakStatement(n)
 		case *nast.ContinueStatement:
@@ -260,7 +651,7 @@ func (c *Converter) mergeNololNestableElements(lines []nast.NestableElement) ([]
 		}
 		inp[i] = line
 	}
-	interm, err := c.mergeStatementElements(inp)
+	interm, err := c.mergeStatementElements(inp, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -272,7 +663,7 @@ func (c *Converter) mergeNololNestableElements(lines []nast.NestableElement) ([]
 }
 
 // mergeNololElements is a type-wrapper for mergeStatementElements
-func (c *Converter) mergeNololElements(lines []nast.Element) ([]nast.Element, error) {
+func (c *Converter) mergeNololElements(lines []nast.Element, explanation *Explanation) ([]nast.Element, error) {
 	inp := make([]*nast.StatementLine, len(lines))
 	for i, elem := range lines {
 		line, isline := elem.(*nast.StatementLine)
@@ -283,7 +674,7 @@ func (c *Converter) mergeNololElements(lines []nast.Element) ([]nast.Element, er
 		}
 		inp[i] = line
 	}
-	interm, err := c.mergeStatementElements(inp)
+	interm, err := c.mergeStatementElements(inp, explanation)
 	if err != nil {
 		return nil, err
 	}
@@ -294,8 +685,9 @@ func (c *Converter) mergeNololElements(lines []nast.Element) ([]nast.Element, er
 	return outp, nil
 }
 
-// mergeStatementElements merges consectuive statementlines into as few lines as possible
-func (c *Converter) mergeStatementElements(lines []*nast.StatementLine) ([]*nast.StatementLine, error) {
+// mergeStatementElements merges consectuive statementlines into as few lines as possible.
+// If explanation is not nil, the origin of every merged line is recorded in it
+func (c *Converter) mergeStatementElements(lines []*nast.StatementLine, explanation *Explanation) ([]*nast.StatementLine, error) {
 	maxlen := c.maxLineLength()
 	newElements := make([]*nast.StatementLine, 0, len(lines))
 	i := 0
@@ -304,23 +696,24 @@ func (c *Converter) mergeStatementElements(lines []*nast.StatementLine) ([]*nast
 			Line: ast.Line{
 				Statements: []ast.Statement{},
 			},
-			Label:    lines[i].Label,
-			Position: lines[i].Position,
-			HasEOL:   lines[i].HasEOL,
+			Label:      lines[i].Label,
+			Position:   lines[i].Position,
+			HasEOL:     lines[i].HasEOL,
+			Raw:        lines[i].Raw,
+			PinnedLine: lines[i].PinnedLine,
 		}
 		current.Statements = append(current.Statements, lines[i].Statements...)
 		newElements = append(newElements, current)
+		explained := c.explainLine(explanation, lines[i])
 
-		if current.HasEOL {
-			// no lines may MUST be appended to a line having EOL
-			i++
-			continue
-		}
-
-		for i+1 < len(lines) {
+		for i+1 < len(lines) && !current.HasEOL {
 			currlen := getLengthOfLine(&current.Line)
 
 			if currlen > maxlen {
+				if explained != nil {
+					explained.Length = currlen
+					explained.Reason = fmt.Sprintf("The line is too long (%d > %d characters)", currlen, maxlen)
+				}
 				return newElements, &parser.Error{
 					Message:       "The line is too long (>70 characters) to be converted to yolol, even after optimization.",
 					StartPosition: current.Start(),
@@ -331,8 +724,9 @@ func (c *Converter) mergeStatementElements(lines []*nast.StatementLine) ([]*nast
 			nextline := lines[i+1]
 			nextlen := getLengthOfLine(&nextline.Line)
 
-			if nextline.Label == "" && currlen+nextlen <= maxlen && !nextline.HasBOL {
+			if c.level != OptimizeNone && nextline.Label == "" && currlen+nextlen <= maxlen && !nextline.HasBOL {
 				current.Statements = append(current.Statements, nextline.Statements...)
+				c.explainSource(explained, nextline)
 				i++
 				if nextline.HasEOL {
 					break
@@ -341,13 +735,23 @@ func (c *Converter) mergeStatementElements(lines []*nast.StatementLine) ([]*nast
 				break
 			}
 		}
+
+		if explained != nil {
+			explained.Length = getLengthOfLine(&current.Line)
+			if i+1 < len(lines) && c.level == OptimizeNone {
+				explained.Reason = "Lines are not merged at optimization-level 0"
+			} else if i+1 < len(lines) {
+				explained.Reason = mergeBreakReason(lines[i], lines[i+1], explained.Length, maxlen)
+			}
+		}
 		i++
 	}
 	return newElements, nil
 }
 
-//getLengthOfLine returns the amount of characters needed to represent the given line as yolol-code
+// getLengthOfLine returns the amount of characters needed to represent the given line as yolol-code
 func getLengthOfLine(line ast.Node) int {
+	line = estimateDynamicGotos(line)
 	ygen := parser.Printer{}
 	ygen.Mode = parser.PrintermodeCompact
 	ygen.UnknownHandlerFunc = func(node ast.Node, visitType int, p *parser.Printer) error {
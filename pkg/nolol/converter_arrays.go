@@ -0,0 +1,355 @@
+package nolol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// arrayDefinition describes a declared array. Every element of the array is stored in its own variable
+type arrayDefinition struct {
+	Name string
+	From int64
+	To   int64
+}
+
+// elementName returns the name of the variable that stores the element with the given index.
+// Elements of global arrays are named like the fields of devices (:lamp1), elements of local arrays are named buf_1
+func (a *arrayDefinition) elementName(index int64) string {
+	if strings.HasPrefix(a.Name, ":") {
+		return fmt.Sprintf("%s%d", a.Name, index)
+	}
+	return fmt.Sprintf("%s_%d", a.Name, index)
+}
+
+// getArray is a case-insensitive getter for c.arrays
+func (c *Converter) getArray(name string, node ast.Node) (*arrayDefinition, error) {
+	arr, exists := c.arrays[strings.ToLower(name)]
+	if !exists {
+		return nil, &parser.Error{
+			Message:       fmt.Sprintf("No array named '%s' declared", name),
+			StartPosition: node.Start(),
+			EndPosition:   node.End(),
+		}
+	}
+	return arr, nil
+}
+
+// convertArrayDeclaration stores the bounds of the declared array and removes the declaration from the code
+func (c *Converter) convertArrayDeclaration(decl *nast.ArrayDeclaration) error {
+	var from, to ast.Expression
+	if decl.Size != nil {
+		from = &ast.NumberConstant{Value: "0"}
+		to = c.staticValue(&ast.BinaryOperation{
+			Operator: "-",
+			Exp1:     decl.Size,
+			Exp2:     &ast.NumberConstant{Value: "1"},
+		})
+	} else {
+		from = c.staticValue(decl.From)
+		to = c.staticValue(decl.To)
+	}
+
+	first, isint := integerValue(from)
+	last, isint2 := integerValue(to)
+	if !isint || !isint2 {
+		return &parser.Error{
+			Message:       "The size of an array must be an integer that is known at compile-time (only constants and definitions can be used)",
+			StartPosition: decl.Start(),
+			EndPosition:   decl.End(),
+		}
+	}
+	if first < 0 || last < first {
+		return &parser.Error{
+			Message:       "The indices of an array can not be negative and the array must have at least one element",
+			StartPosition: decl.Start(),
+			EndPosition:   decl.End(),
+		}
+	}
+
+	c.arrays[strings.ToLower(decl.Name)] = &arrayDefinition{
+		Name: decl.Name,
+		From: first,
+		To:   last,
+	}
+	return ast.NewNodeReplacementSkip()
+}
+
+// integerValue returns the value of exp, if exp is a constant integer
+func integerValue(exp ast.Expression) (int64, bool) {
+	constant, isconst := exp.(*ast.NumberConstant)
+	if !isconst {
+		return 0, false
+	}
+	number := vm.VariableFromString(constant.Value).Number()
+	if !number.Truncate(0).Equal(number) {
+		return 0, false
+	}
+	return number.IntPart(), true
+}
+
+// constantIndex returns the value of the index, if it is known at compile-time.
+// Returns an error if the constant index is outside of the array
+func (c *Converter) constantIndex(arr *arrayDefinition, index ast.Expression) (int64, bool, error) {
+	value, isconst := integerValue(c.staticValue(index))
+	if !isconst {
+		return 0, false, nil
+	}
+	if value < arr.From || value > arr.To {
+		return 0, true, &parser.Error{
+			Message:       fmt.Sprintf("The index %d is out of range for the array '%s' (%d to %d)", value, arr.Name, arr.From, arr.To),
+			StartPosition: index.Start(),
+			EndPosition:   index.End(),
+		}
+	}
+	return value, true, nil
+}
+
+// convertArrayAccess replaces the access to an array with a constant index by the variable of the element
+func (c *Converter) convertArrayAccess(access *nast.ArrayAccess) error {
+	arr, err := c.getArray(access.Array, access)
+	if err != nil {
+		return err
+	}
+	index, isconst, err := c.constantIndex(arr, access.Index)
+	if err != nil {
+		return err
+	}
+	if !isconst {
+		// accesses inside of statement-lines have already been replaced by hoistArrayAccesses
+		return &parser.Error{
+			Message:       "Arrays can only be accessed using an index that is not known at compile-time inside the statements of a line, but not in conditions of nolol-constructs",
+			StartPosition: access.Start(),
+			EndPosition:   access.End(),
+		}
+	}
+	return ast.NewNodeReplacementSkip(&ast.Dereference{
+		Position: access.Position,
+		Variable: c.variableName(arr.elementName(index)),
+	})
+}
+
+// convertArrayAssignment replaces the assignment to an array with a constant index by an assignment to the variable of the element
+func (c *Converter) convertArrayAssignment(assignment *nast.ArrayAssignment) error {
+	arr, err := c.getArray(assignment.Array, assignment)
+	if err != nil {
+		return err
+	}
+	index, isconst, err := c.constantIndex(arr, assignment.Index)
+	if err != nil {
+		return err
+	}
+	if !isconst {
+		// assignments inside of statement-lines have already been replaced by hoistArrayAccesses
+		return &parser.Error{
+			Message:       "Assignments to arrays using an index that is not known at compile-time can only be used in the statements of a line",
+			StartPosition: assignment.Start(),
+			EndPosition:   assignment.End(),
+		}
+	}
+	return ast.NewNodeReplacementSkip(&ast.Assignment{
+		Position: assignment.Position,
+		Variable: c.variableName(arr.elementName(index)),
+		Operator: assignment.Operator,
+		Value:    assignment.Value,
+	})
+}
+
+// hoistArrayAccesses replaces the accesses to arrays with an index that is only known at runtime.
+// A line containing an assignment to such an array is split and the assignment is replaced by a switch over the index.
+// Reads are replaced by a switch before the line, that copies the element into a temporary variable.
+// If anything has been replaced, the replacement for the line is returned as error
+func (c *Converter) hoistArrayAccesses(line *nast.StatementLine) error {
+	for i, stmt := range line.Statements {
+		assignment, isassignment := stmt.(*nast.ArrayAssignment)
+		if !isassignment {
+			continue
+		}
+		arr, err := c.getArray(assignment.Array, assignment)
+		if err != nil {
+			return err
+		}
+		_, isconst, err := c.constantIndex(arr, assignment.Index)
+		if err != nil || isconst {
+			return err
+		}
+
+		repl := []ast.Node{}
+		if i > 0 {
+			repl = append(repl, &nast.StatementLine{
+				Position: line.Position,
+				Line: ast.Line{
+					Position:   line.Line.Position,
+					Statements: line.Statements[:i],
+				},
+			})
+		}
+
+		c.arraycounter++
+		value := assignment.Value
+		// the value must be computed before the index (like for any other assignment)
+		if !isConstant(value) {
+			tmpvar := fmt.Sprintf("_value%d", c.arraycounter)
+			repl = append(repl, &nast.StatementLine{
+				Position: assignment.Position,
+				Line: ast.Line{
+					Position: assignment.Position,
+					Statements: []ast.Statement{
+						&ast.Assignment{
+							Position: assignment.Position,
+							Variable: tmpvar,
+							Operator: "=",
+							Value:    value,
+						},
+					},
+				},
+			})
+			value = &ast.Dereference{
+				Position: value.Start(),
+				Variable: tmpvar,
+			}
+		}
+
+		repl = append(repl, c.arraySwitch(arr, assignment.Index, func(element string) ast.Statement {
+			return &ast.Assignment{
+				Position: assignment.Position,
+				Variable: element,
+				Operator: assignment.Operator,
+				Value:    nast.CopyAst(value).(ast.Expression),
+			}
+		})...)
+
+		if i < len(line.Statements)-1 || line.HasEOL || line.Comment != "" {
+			repl = append(repl, &nast.StatementLine{
+				Position: line.Position,
+				Line: ast.Line{
+					Position:   line.Line.Position,
+					Statements: line.Statements[i+1:],
+				},
+				HasEOL:  line.HasEOL,
+				Comment: line.Comment,
+			})
+		}
+		return ast.NewNodeReplacement(moveLineStart(line, repl)...)
+	}
+
+	hoisted := []ast.Node{}
+	err := line.Line.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		access, isaccess := node.(*nast.ArrayAccess)
+		if !isaccess || visitType != ast.PreVisit {
+			return nil
+		}
+		arr, err := c.getArray(access.Array, access)
+		if err != nil {
+			return err
+		}
+		_, isconst, err := c.constantIndex(arr, access.Index)
+		if err != nil || isconst {
+			return err
+		}
+		c.arraycounter++
+		tmpvar := fmt.Sprintf("_element%d", c.arraycounter)
+		hoisted = append(hoisted, c.arraySwitch(arr, access.Index, func(element string) ast.Statement {
+			return &ast.Assignment{
+				Position: access.Position,
+				Variable: tmpvar,
+				Operator: "=",
+				Value: &ast.Dereference{
+					Position: access.Position,
+					Variable: element,
+				},
+			}
+		})...)
+		return ast.NewNodeReplacementSkip(&ast.Dereference{
+			Position: access.Position,
+			Variable: tmpvar,
+		})
+	}))
+	if err != nil || len(hoisted) == 0 {
+		return err
+	}
+	return ast.NewNodeReplacement(moveLineStart(line, append(hoisted, line))...)
+}
+
+// arraySwitch generates a switch over the index, with one case per element of the array.
+// The switch is later converted to an if-chain or a jump-table, whatever is shorter.
+// If the index is a complex expression, it is stored in a variable first. This way, it can itself contain accesses to arrays
+func (c *Converter) arraySwitch(arr *arrayDefinition, index ast.Expression, stmt func(element string) ast.Statement) []ast.Node {
+	repl := []ast.Node{}
+	if deref, isderef := index.(*ast.Dereference); !isderef || deref.Operator != "" {
+		tmpvar := fmt.Sprintf("_index%d", c.arraycounter)
+		repl = append(repl, &nast.StatementLine{
+			Position: index.Start(),
+			Line: ast.Line{
+				Position: index.Start(),
+				Statements: []ast.Statement{
+					&ast.Assignment{
+						Position: index.Start(),
+						Variable: tmpvar,
+						Operator: "=",
+						Value:    index,
+					},
+				},
+			},
+		})
+		index = &ast.Dereference{
+			Position: index.Start(),
+			Variable: tmpvar,
+		}
+	}
+
+	sw := &nast.SwitchStatement{
+		Position: index.Start(),
+		Value:    index,
+		Cases:    make([]*nast.SwitchCase, 0, arr.To-arr.From+1),
+	}
+	for i := arr.From; i <= arr.To; i++ {
+		sw.Cases = append(sw.Cases, &nast.SwitchCase{
+			Position: index.Start(),
+			Values: []ast.Expression{
+				&ast.NumberConstant{
+					Position: index.Start(),
+					Value:    fmt.Sprint(i),
+				},
+			},
+			Block: &nast.Block{
+				Elements: []nast.NestableElement{
+					&nast.StatementLine{
+						Position: index.Start(),
+						Line: ast.Line{
+							Position:   index.Start(),
+							Statements: []ast.Statement{stmt(arr.elementName(i))},
+						},
+					},
+				},
+			},
+		})
+	}
+	return append(repl, sw)
+}
+
+// moveLineStart moves the label (including its pinned line-number) and the BOL of the given line to the beginning of the replacement for the line.
+// This way jumps to the label also execute the code that has been inserted before the line
+func moveLineStart(line *nast.StatementLine, repl []ast.Node) []ast.Node {
+	if line.Label == "" && !line.HasBOL {
+		return repl
+	}
+	first := &nast.StatementLine{
+		Position: line.Position,
+		Line: ast.Line{
+			Position:   line.Line.Position,
+			Statements: []ast.Statement{},
+		},
+		Label:      line.Label,
+		HasBOL:     line.HasBOL,
+		PinnedLine: line.PinnedLine,
+	}
+	line.Label = ""
+	line.PinnedLine = 0
+	line.HasBOL = false
+	return append([]ast.Node{first}, repl...)
+}
@@ -0,0 +1,147 @@
+package nolol
+
+import (
+	"fmt"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// AssertionVariable is the global variable that is set to the message of a failed assertion (or to 1, if the assertion has no message)
+const AssertionVariable = ":nolol_assert"
+
+// AssertionError is reported when an assertion of a nolol-program fails at runtime
+type AssertionError struct {
+	// the position of the assertion in the nolol-code
+	Position ast.Position
+	Message  string
+}
+
+func (e *AssertionError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Assertion failed at %s", e.Position)
+	}
+	return fmt.Sprintf("Assertion failed at %s: %s", e.Position, e.Message)
+}
+
+// AssertionFailure checks if the runtime-error err of the given vm has been raised by a failed assertion.
+// If so, an AssertionError containing the position and the message of the assertion is returned. Otherwise err is returned unchanged
+func AssertionFailure(v *vm.VM, err error) error {
+	rterr, isrterr := err.(vm.RuntimeError)
+	if !isrterr {
+		return err
+	}
+	// a failed assertion raises the error by dividing the AssertionVariable by zero
+	binop, isbinop := rterr.Node.(*ast.BinaryOperation)
+	if !isbinop {
+		return err
+	}
+	deref, isderef := binop.Exp1.(*ast.Dereference)
+	if !isderef || deref.Variable != AssertionVariable {
+		return err
+	}
+	message := ""
+	if value, exists := v.GetVariable(AssertionVariable); exists && value.IsString() {
+		message = value.String()
+	}
+	return &AssertionError{
+		Position: deref.Start(),
+		Message:  message,
+	}
+}
+
+// SetRelease enables or disables the release-mode. In release-mode, assertions and debug-blocks are removed from the program
+func (c *Converter) SetRelease(release bool) {
+	c.release = release
+}
+
+// convertAssertion converts an assertion to an if, that sets the AssertionVariable and raises a runtime-error if the condition is false.
+// Conditions that are known at compile-time are checked during compilation (even in release-mode)
+func (c *Converter) convertAssertion(assertion *nast.Assertion) error {
+	condition := c.staticValue(assertion.Condition)
+	if constant, isconst := condition.(*ast.NumberConstant); isconst {
+		if vm.VariableFromString(constant.Value).Number().IsZero() {
+			message := "Assertion failed"
+			if assertion.Message != "" {
+				message += ": " + assertion.Message
+			}
+			return &parser.Error{
+				Message:       message,
+				StartPosition: assertion.Start(),
+				EndPosition:   assertion.End(),
+			}
+		}
+		return ast.NewNodeReplacementSkip()
+	}
+
+	if c.release {
+		return ast.NewNodeReplacementSkip()
+	}
+
+	var value ast.Expression = &ast.NumberConstant{
+		Position: assertion.Position,
+		Value:    "1",
+	}
+	if assertion.Message != "" {
+		value = &ast.StringConstant{
+			Position: assertion.Position,
+			Value:    assertion.Message,
+		}
+	}
+
+	// both statements are positioned at the assertion. This way the runtime-error points to the assertion
+	statementLine := func(stmt ast.Statement) *nast.StatementLine {
+		return &nast.StatementLine{
+			Position: assertion.Position,
+			Line: ast.Line{
+				Position:   assertion.Position,
+				Statements: []ast.Statement{stmt},
+			},
+		}
+	}
+	return ast.NewNodeReplacement(&nast.MultilineIf{
+		Positions: []ast.Position{assertion.Position},
+		Conditions: []ast.Expression{
+			&ast.UnaryOperation{
+				Position: assertion.Position,
+				Operator: "not",
+				Exp:      assertion.Condition,
+			},
+		},
+		Blocks: []*nast.Block{
+			{
+				Elements: []nast.NestableElement{
+					statementLine(&ast.Assignment{
+						Position: assertion.Position,
+						Variable: AssertionVariable,
+						Operator: "=",
+						Value:    value,
+					}),
+					statementLine(&ast.Assignment{
+						Position: assertion.Position,
+						Variable: AssertionVariable,
+						Operator: "/=",
+						Value: &ast.NumberConstant{
+							Position: assertion.Position,
+							Value:    "0",
+						},
+					}),
+				},
+			},
+		},
+	})
+}
+
+// convertDebugBlock inserts the contents of the block, if the program is not compiled in release-mode
+func (c *Converter) convertDebugBlock(debug *nast.DebugBlock) error {
+	if c.release {
+		return ast.NewNodeReplacementSkip()
+	}
+	repl := make([]ast.Node, len(debug.Block.Elements))
+	for i, element := range debug.Block.Elements {
+		repl[i] = element
+	}
+	return ast.NewNodeReplacement(repl...)
+}
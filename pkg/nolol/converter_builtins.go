@@ -12,30 +12,95 @@ import (
 // reservedTimeVariable is the variable used to track passed time
 var reservedTimeVariable = "_time"
 
+// reservedTimeoutVariable is the variable used to store the deadline of a wait with timeout (or a sleep)
+var reservedTimeoutVariable = "_timeout"
+
 // convert a wait directive to yolol
 func (c *Converter) convertWait(wait *nast.WaitDirective) error {
+	if wait.Timeout == nil {
+		c.warnConstantWait(wait)
+	}
 	label := fmt.Sprintf("wait%d", c.waitlabelcounter)
+	c.waitlabelcounter++
+	repeat := []ast.Statement{
+		&nast.GoToLabelStatement{
+			Label: label,
+		},
+	}
 	line := &nast.StatementLine{
-		Label:  label,
-		HasEOL: true,
+		Position: wait.Start(),
+		Label:    label,
+		HasEOL:   true,
 		Line: ast.Line{
 			Position: wait.Start(),
-			Statements: []ast.Statement{
+		},
+	}
+	replacements := []ast.Node{}
+
+	if wait.Timeout == nil {
+		line.Statements = []ast.Statement{
+			&ast.IfStatement{
+				Position:  wait.Start(),
+				Condition: wait.Condition,
+				IfBlock:   repeat,
+			},
+		}
+		if wait.Statements != nil {
+			line.Statements = append(line.Statements, wait.Statements...)
+		}
+	} else {
+		c.usesTimeTracking = true
+		// the deadline is computed once, before the waiting starts
+		replacements = append(replacements, c.deadlineLine(wait.Timeout))
+		intime := &ast.BinaryOperation{
+			Operator: "<",
+			Exp1: &ast.Dereference{
+				Variable: c.variableName(reservedTimeVariable),
+			},
+			Exp2: &ast.Dereference{
+				Variable: c.variableName(reservedTimeoutVariable),
+			},
+		}
+		if number, isnumber := wait.Condition.(*ast.NumberConstant); isnumber && number.Value != "0" && wait.Statements == nil && wait.Else == nil {
+			// the condition is always true (for example for a sleep). Only the time needs to be checked
+			line.Statements = []ast.Statement{
 				&ast.IfStatement{
 					Position:  wait.Start(),
-					Condition: wait.Condition,
-					IfBlock: []ast.Statement{
-						&nast.GoToLabelStatement{
-							Label: label,
-						},
+					Condition: intime,
+					IfBlock:   repeat,
+				},
+			}
+		} else if wait.Statements == nil && wait.Else == nil {
+			line.Statements = []ast.Statement{
+				&ast.IfStatement{
+					Position: wait.Start(),
+					Condition: &ast.BinaryOperation{
+						Operator: "and",
+						Exp1:     wait.Condition,
+						Exp2:     intime,
 					},
+					IfBlock: repeat,
 				},
-			},
-		},
-	}
-	if wait.Statements != nil {
-		line.Statements = append(line.Statements, wait.Statements...)
+			}
+		} else {
+			// the condition is only evaluated once per iteration. If it is still true, the timeout has been reached
+			timedout := append([]ast.Statement{
+				&ast.IfStatement{
+					Condition: intime,
+					IfBlock:   repeat,
+				},
+			}, wait.Else...)
+			line.Statements = []ast.Statement{
+				&ast.IfStatement{
+					Position:  wait.Start(),
+					Condition: wait.Condition,
+					IfBlock:   timedout,
+					ElseBlock: wait.Statements,
+				},
+			}
+		}
 	}
+
 	if getLengthOfLine(&line.Line) > c.maxLineLength() {
 		return &parser.Error{
 			Message:       "The line is too long to be converted to yolol",
@@ -43,22 +108,81 @@ func (c *Converter) convertWait(wait *nast.WaitDirective) error {
 			EndPosition:   wait.End(),
 		}
 	}
-	return ast.NewNodeReplacementSkip(line)
+	replacements = append(replacements, line)
+	return ast.NewNodeReplacementSkip(replacements...)
 }
 
-// convert a built-in function to yolol
+// convertSleep converts a sleep into a wait with timeout, whose condition is always true
+func (c *Converter) convertSleep(sleep *nast.Sleep) error {
+	return ast.NewNodeReplacement(&nast.WaitDirective{
+		Position: sleep.Start(),
+		Condition: &ast.NumberConstant{
+			Position: sleep.Start(),
+			Value:    "1",
+		},
+		Timeout: sleep.Duration,
+	})
+}
+
+// deadlineLine returns a line that stores the time after the given number of lines in the timeout-variable
+func (c *Converter) deadlineLine(duration ast.Expression) *nast.StatementLine {
+	return &nast.StatementLine{
+		Position: duration.Start(),
+		Line: ast.Line{
+			Position: duration.Start(),
+			Statements: []ast.Statement{
+				&ast.Assignment{
+					Position: duration.Start(),
+					Variable: c.variableName(reservedTimeoutVariable),
+					Operator: "=",
+					Value: &ast.BinaryOperation{
+						Operator: "+",
+						Exp1: &ast.Dereference{
+							Variable: c.variableName(reservedTimeVariable),
+						},
+						Exp2: duration,
+					},
+				},
+			},
+		},
+	}
+}
+
+// unaryFunctions are the functions of yolol. They are all implemented as unary operators
+var unaryFunctions = []string{"abs", "sqrt", "sin", "cos", "tan", "asin", "acos", "atan"}
+
+// isBuiltinFunction checks if the given function is a built-in function. Built-in functions take precedence over macros
+func isBuiltinFunction(name string) bool {
+	name = strings.ToLower(name)
+	if name == "time" {
+		return true
+	}
+	for _, unaryop := range unaryFunctions {
+		if unaryop == name {
+			return true
+		}
+	}
+	return false
+}
+
+// convert a built-in function or an expression-macro to yolol
 func (c *Converter) convertFuncCall(function *nast.FuncCall) error {
 	nfunc := strings.ToLower(function.Function)
 	switch nfunc {
+	case "sleep":
+		return &parser.Error{
+			Message:       "sleep() can only be used as a statement on its own line",
+			StartPosition: function.Start(),
+			EndPosition:   function.End(),
+		}
 	case "time":
 		// time is a nolol-built-in function
 		c.usesTimeTracking = true
 		return ast.NewNodeReplacementSkip(&ast.Dereference{
-			Variable: c.varnameOptimizer.OptimizeVarName(reservedTimeVariable),
+			Variable: c.variableName(reservedTimeVariable),
 		})
 	}
-	unaryops := []string{"abs", "sqrt", "sin", "cos", "tan", "asin", "acos", "atan"}
-	for _, unaryop := range unaryops {
+	for _, unaryop := range unaryFunctions {
 		if unaryop == nfunc {
 			if len(function.Arguments) != 1 {
 				return &parser.Error{
@@ -74,6 +198,21 @@ func (c *Converter) convertFuncCall(function *nast.FuncCall) error {
 			})
 		}
 	}
+	if m, isMacro := c.getMacro(function.Function); isMacro {
+		if m.Expression == nil {
+			// calls of block-macros inside of statements have already been replaced by hoistMacroCalls
+			return &parser.Error{
+				Message:       fmt.Sprintf("The macro '%s' contains a block. It can only be used inside the statements of a line, but not in conditions of nolol-constructs", function.Function),
+				StartPosition: function.Start(),
+				EndPosition:   function.End(),
+			}
+		}
+		expanded, err := c.expandExpressionMacro(function, m)
+		if err != nil {
+			return err
+		}
+		return ast.NewNodeReplacement(expanded)
+	}
 	return &parser.Error{
 		Message:       "Unknown function: " + function.Function,
 		StartPosition: function.Start(),
@@ -85,10 +224,17 @@ func (c *Converter) convertFuncCall(function *nast.FuncCall) error {
 func usesTimeTracking(n ast.Node) bool {
 	uses := false
 	f := func(node ast.Node, visitType int) error {
-		if function, is := node.(*nast.FuncCall); is {
-			if function.Function == "time" {
+		switch n := node.(type) {
+		case *nast.FuncCall:
+			if n.Function == "time" {
+				uses = true
+			}
+		case *nast.WaitDirective:
+			if n.Timeout != nil {
 				uses = true
 			}
+		case *nast.Sleep:
+			uses = true
 		}
 		return nil
 	}
@@ -101,14 +247,32 @@ func (c *Converter) insertLineCounter(p *nast.Program) {
 	for _, line := range p.Elements {
 		if stmtline, is := line.(*nast.StatementLine); is {
 			stmts := make([]ast.Statement, 1, len(stmtline.Statements)+1)
-			stmts[0] = &ast.Dereference{
-				Variable:    c.varnameOptimizer.OptimizeVarName(reservedTimeVariable),
-				Operator:    "++",
-				PrePost:     "Post",
-				IsStatement: true,
-			}
+			stmts[0] = c.lineCounter()
 			stmts = append(stmts, stmtline.Statements...)
 			stmtline.Statements = stmts
 		}
 	}
 }
+
+// lineCounter returns the statement that counts the executed lines for time-tracking
+func (c *Converter) lineCounter() ast.Statement {
+	return &ast.Dereference{
+		Variable:    c.variableName(reservedTimeVariable),
+		Operator:    "++",
+		PrePost:     "Post",
+		IsStatement: true,
+	}
+}
+
+// lineCounterLength returns the number of characters the line-counter adds to every line. 0 if time is not tracked
+func (c *Converter) lineCounterLength() int {
+	if !c.usesTimeTracking {
+		return 0
+	}
+	// the counter is separated from the other statements of the line by a space
+	return getLengthOfLine(&ast.Line{
+		Statements: []ast.Statement{c.lineCounter(), c.lineCounter()},
+	}) - getLengthOfLine(&ast.Line{
+		Statements: []ast.Statement{c.lineCounter()},
+	})
+}
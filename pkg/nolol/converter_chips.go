@@ -0,0 +1,346 @@
+package nolol
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// the global variables used to transfer control between chips
+const (
+	// contains the number (starting at 0) of the chip that is currently running
+	chipVariable = ":nolol_chip"
+	// contains the line (minus 2) at which the next chip starts running
+	chipLineVariable = ":nolol_line"
+)
+
+// chipEntry is a placeholder for the line at which a chip is entered. The line is only known after all lines have been merged
+type chipEntry struct {
+	value *ast.NumberConstant
+	chip  int
+	label string
+}
+
+// ConvertChipsFile acts like ConvertFile, but allows the program to be split into multiple chips
+func (c *Converter) ConvertChipsFile(mainfile string) ([]*ast.Program, error) {
+	files := DiskFileSystem{
+		Dir: filepath.Dir(mainfile),
+	}
+	return c.ConvertChipsFileEx(filepath.Base(mainfile), files)
+}
+
+// ConvertChipsFileEx acts like ConvertFileEx, but allows the program to be split into multiple chips
+func (c *Converter) ConvertChipsFileEx(mainfile string, files FileSystem) ([]*ast.Program, error) {
+	c.mainfile = mainfile
+	file, err := files.Get(mainfile)
+	if err != nil {
+		return nil, err
+	}
+	p := NewParser()
+	p.Debug(c.debug)
+	parsed, err := p.Parse(file)
+	if err != nil {
+		return nil, err
+	}
+	return c.ConvertChips(parsed, files)
+}
+
+// ConvertChips converts a nolol-program, that can be split into multiple chips using #chip, to one yolol-program per chip.
+// Only one of the chips is running at a time. The others wait until control is transferred to them.
+// Control is transferred when the end of the code of a chip is reached (to the next chip) or when a goto leads to a label on another chip.
+// This is done using the global variables :nolol_chip and :nolol_line.
+// Local variables can not be shared between chips.
+// If one of the chips is too large, the programs are returned together with an error
+func (c *Converter) ConvertChips(prog *nast.Program, files FileSystem) ([]*ast.Program, error) {
+	c.explanations = []*Explanation{}
+	err := c.preprocess(prog, files)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := splitChips(prog)
+	var entries []*chipEntry
+	if len(sections) > 1 {
+		entries, err = c.prepareChips(sections)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	labels := make([]map[string]int, len(sections))
+	for i, section := range sections {
+		err = c.mergeLines(section)
+		if err != nil {
+			return nil, err
+		}
+		labels[i] = c.jumpLabels
+	}
+
+	for _, entry := range entries {
+		line := 2
+		if entry.label != "" {
+			line = labels[entry.chip][entry.label]
+		}
+		entry.value.Value = strconv.Itoa(line - 2)
+	}
+
+	chips := make([]*ast.Program, len(sections))
+	var chipErr error
+	for i, section := range sections {
+		c.jumpLabels = labels[i]
+		out, err := c.toYolol(section)
+		if out == nil {
+			return nil, err
+		}
+		c.explanations[i].LineCounterLength = c.lineCounterLength()
+		if err != nil {
+			if perr, isperr := err.(*parser.Error); isperr && len(sections) > 1 {
+				perr.Message = fmt.Sprintf("Chip %d: %s", i+1, perr.Message)
+			}
+			chipErr = err
+		}
+		chips[i] = out
+	}
+	c.renameByUsage(chips)
+	return chips, chipErr
+}
+
+// splitChips splits the elements of the program at the chip-boundaries. Empty chips are removed.
+func splitChips(prog *nast.Program) []*nast.Program {
+	sections := []*nast.Program{}
+	current := &nast.Program{
+		Elements: []nast.Element{},
+	}
+	for _, element := range prog.Elements {
+		if _, isboundary := element.(*nast.ChipBoundary); isboundary {
+			if len(current.Elements) > 0 {
+				sections = append(sections, current)
+			}
+			current = &nast.Program{
+				Elements: []nast.Element{},
+			}
+			continue
+		}
+		current.Elements = append(current.Elements, element)
+	}
+	if len(current.Elements) > 0 || len(sections) == 0 {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// prepareChips adds the code for transferring control between the chips.
+// Returns the placeholders for the lines at which the chips are entered
+func (c *Converter) prepareChips(sections []*nast.Program) ([]*chipEntry, error) {
+	if c.usesTimeTracking {
+		return nil, &parser.Error{
+			Message:       "time() can not be used in programs that are split into multiple chips",
+			StartPosition: ast.NewPosition("", 1, 1),
+			EndPosition:   ast.NewPosition("", 1, 1),
+		}
+	}
+
+	err := c.checkSharedVariables(sections)
+	if err != nil {
+		return nil, err
+	}
+
+	labelChips := make(map[string]int)
+	for i, section := range sections {
+		for _, element := range section.Elements {
+			if line, isline := element.(*nast.StatementLine); isline && line.Label != "" {
+				labelChips[line.Label] = i
+			}
+		}
+	}
+
+	// chips that are entered at a label need to know at which line to start
+	needsLine := make([]bool, len(sections))
+	for i, section := range sections {
+		err := section.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			switch n := node.(type) {
+			case *nast.GoToLabelStatement:
+				if chip, exists := labelChips[n.Label]; exists && chip != i {
+					needsLine[chip] = true
+				}
+			case *nast.DynamicGoToStatement:
+				for _, label := range n.Labels {
+					if chip, exists := labelChips[label]; exists && chip != i {
+						return &parser.Error{
+							Message:       "The labels of a dynamic goto must be on the same chip as the goto",
+							StartPosition: n.Start(),
+							EndPosition:   n.End(),
+						}
+					}
+				}
+			}
+			return nil
+		}))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := []*chipEntry{}
+	handover := func(chip int, label string, pos ast.Position) []ast.Statement {
+		stmts := []ast.Statement{
+			&ast.Assignment{
+				Position: pos,
+				Variable: chipVariable,
+				Operator: "=",
+				Value: &ast.NumberConstant{
+					Position: pos,
+					Value:    strconv.Itoa(chip),
+				},
+			},
+		}
+		if needsLine[chip] {
+			entry := &chipEntry{
+				// the real value is inserted later. The placeholder is as long as the longest possible value
+				value: &ast.NumberConstant{
+					Position: pos,
+					Value:    "99",
+				},
+				chip:  chip,
+				label: label,
+			}
+			entries = append(entries, entry)
+			stmts = append(stmts, &ast.Assignment{
+				Position: pos,
+				Variable: chipLineVariable,
+				Operator: "=",
+				Value:    entry.value,
+			})
+		}
+		return append(stmts, &ast.GoToStatement{
+			Position: pos,
+			Line: &ast.NumberConstant{
+				Position: pos,
+				Value:    "1",
+			},
+		})
+	}
+
+	for i, section := range sections {
+		err := section.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			if gotostmt, isgoto := node.(*nast.GoToLabelStatement); isgoto {
+				if chip, exists := labelChips[gotostmt.Label]; exists && chip != i {
+					stmts := handover(chip, gotostmt.Label, gotostmt.Position)
+					repl := make([]ast.Node, len(stmts))
+					for j, stmt := range stmts {
+						repl[j] = stmt
+					}
+					return ast.NewNodeReplacementSkip(repl...)
+				}
+			}
+			return nil
+		}))
+		if err != nil {
+			return nil, err
+		}
+
+		// wait until this chip is activated
+		wait := []ast.Statement{
+			&ast.IfStatement{
+				Condition: &ast.BinaryOperation{
+					Operator: "!=",
+					Exp1: &ast.Dereference{
+						Variable: chipVariable,
+					},
+					Exp2: &ast.NumberConstant{
+						Value: strconv.Itoa(i),
+					},
+				},
+				IfBlock: []ast.Statement{
+					&ast.GoToStatement{
+						Line: &ast.NumberConstant{
+							Value: "1",
+						},
+					},
+				},
+			},
+		}
+		if needsLine[i] {
+			wait = append(wait, &ast.GoToStatement{
+				Line: &ast.BinaryOperation{
+					Operator: "+",
+					Exp1: &ast.NumberConstant{
+						Value: "2",
+					},
+					Exp2: &ast.Dereference{
+						Variable: chipLineVariable,
+					},
+				},
+			})
+		}
+
+		var end ast.Position
+		if len(section.Elements) > 0 {
+			end = section.Elements[len(section.Elements)-1].End()
+		}
+		elements := make([]nast.Element, 0, len(section.Elements)+2)
+		elements = append(elements, &nast.StatementLine{
+			Line: ast.Line{
+				Statements: wait,
+			},
+			HasEOL: needsLine[i],
+		})
+		elements = append(elements, section.Elements...)
+		elements = append(elements, &nast.StatementLine{
+			Position: end,
+			Line: ast.Line{
+				Statements: handover((i+1)%len(sections), "", end),
+			},
+		})
+		section.Elements = elements
+	}
+
+	return entries, nil
+}
+
+// checkSharedVariables returns an error if a local variable is used on more than one chip
+func (c *Converter) checkSharedVariables(sections []*nast.Program) error {
+	translations := c.GetVariableTranslations()
+	chips := make(map[string]int)
+	for i, section := range sections {
+		err := section.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			var name string
+			switch n := node.(type) {
+			case *ast.Dereference:
+				name = n.Variable
+			case *ast.Assignment:
+				if visitType != ast.PreVisit {
+					return nil
+				}
+				name = n.Variable
+			default:
+				return nil
+			}
+			name = strings.ToLower(name)
+			if strings.HasPrefix(name, ":") {
+				return nil
+			}
+			if chip, exists := chips[name]; exists && chip != i {
+				if original, exists := translations[name]; exists {
+					name = original
+				}
+				return &parser.Error{
+					Message:       fmt.Sprintf("The local variable '%s' is used on multiple chips. Use a global variable to share values between chips", name),
+					StartPosition: node.Start(),
+					EndPosition:   node.End(),
+				}
+			}
+			chips[name] = i
+			return nil
+		}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
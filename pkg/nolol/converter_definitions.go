@@ -1,11 +1,13 @@
 package nolol
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
 	"github.com/dbaumgarten/yodk/pkg/parser"
 	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
 // getDefinition is a case-insensitive getter for c.definitions
@@ -21,12 +23,70 @@ func (c *Converter) setDefinition(name string, val ast.Expression) {
 	c.definitions[name] = val
 }
 
+// Define adds a definition, that overrides any definition with the same name in the converted code
+func (c *Converter) Define(name string, value ast.Expression) {
+	c.overrides[strings.ToLower(name)] = value
+	c.setDefinition(name, value)
+}
+
+// ParseDefinition parses a definition in the form name=value, as given on the command-line.
+// The value can be any nolol-expression. If the value is omitted, it is 1.
+func ParseDefinition(definition string) (*nast.Definition, error) {
+	code := "define " + definition
+	if !strings.Contains(definition, "=") {
+		code += "=1"
+	}
+	prog, err := NewParser().Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	if len(prog.Elements) == 1 {
+		if def, isdef := prog.Elements[0].(*nast.Definition); isdef {
+			return def, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid definition '%s'. Expected name=value", definition)
+}
+
 // convertDefinitions converts a definition to yolol by discarding it, but saving the defined value
 func (c *Converter) convertDefinition(decl *nast.Definition) error {
-	c.setDefinition(decl.Name, decl.Value)
+	lname := strings.ToLower(decl.Name)
+	if _, overridden := c.overrides[lname]; !overridden {
+		// the same definition is converted multiple times, if it is inside a macro or a loop
+		if previous, exists := c.definitionPositions[lname]; exists && previous != decl.Start() {
+			c.warn(fmt.Sprintf("The definition of '%s' shadows an earlier definition (at %s)", decl.Name, previous), decl.Start(), decl.End())
+		}
+		c.definitionPositions[lname] = decl.Start()
+		c.setDefinition(decl.Name, decl.Value)
+	}
 	return ast.NewNodeReplacement()
 }
 
+// convertCompileTimeIf replaces a #if by the contents of one of its blocks
+func (c *Converter) convertCompileTimeIf(cif *nast.CompileTimeIf) error {
+	condition := c.staticValue(cif.Condition)
+	constant, isconst := condition.(*ast.NumberConstant)
+	if !isconst {
+		return &parser.Error{
+			Message:       "The condition of #if must be a number that is known at compile-time (only constants and definitions can be used)",
+			StartPosition: cif.Condition.Start(),
+			EndPosition:   cif.Condition.End(),
+		}
+	}
+
+	block := cif.IfBlock
+	if vm.VariableFromString(constant.Value).Number().IsZero() {
+		block = cif.ElseBlock
+	}
+	repl := []ast.Node{}
+	if block != nil {
+		for _, element := range block.Elements {
+			repl = append(repl, element)
+		}
+	}
+	return ast.NewNodeReplacement(repl...)
+}
+
 // convertAssignment optimizes the variable name and the expression of an assignment
 func (c *Converter) convertAssignment(ass *ast.Assignment) error {
 	if replacement, exists := c.getDefinition(ass.Variable); exists {
@@ -40,7 +100,11 @@ func (c *Converter) convertAssignment(ass *ast.Assignment) error {
 			}
 		}
 	} else {
-		ass.Variable = c.varnameOptimizer.OptimizeVarName(ass.Variable)
+		err := checkQualifiedName(ass.Variable, ass)
+		if err != nil {
+			return err
+		}
+		ass.Variable = c.variableName(ass.Variable)
 	}
 	return nil
 }
@@ -71,6 +135,23 @@ func (c *Converter) convertDereference(deref *ast.Dereference) error {
 		return ast.NewNodeReplacementSkip(replacement)
 	}
 	// we are dereferencing a variable
-	deref.Variable = c.varnameOptimizer.OptimizeVarName(deref.Variable)
+	err := checkQualifiedName(deref.Variable, deref)
+	if err != nil {
+		return err
+	}
+	deref.Variable = c.variableName(deref.Variable)
+	return nil
+}
+
+// checkQualifiedName returns an error if name is qualified with a namespace (lib.name).
+// Qualified names must refer to definitions, as variables can not be part of a namespace
+func checkQualifiedName(name string, node ast.Node) error {
+	if strings.Contains(name, ".") {
+		return &parser.Error{
+			Message:       fmt.Sprintf("There is no definition named '%s'", name),
+			StartPosition: node.Start(),
+			EndPosition:   node.End(),
+		}
+	}
 	return nil
 }
@@ -0,0 +1,100 @@
+package nolol
+
+import (
+	"fmt"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// Explanation describes how the lines of a generated yolol-program (of one chip) have been created
+type Explanation struct {
+	// one entry for every generated line
+	Lines []*LineExplanation
+	// the number of characters the statements of a line can use
+	MaxLineLength int
+	// the number of characters the line-counter (used for time-tracking) adds to every line. 0 if time is not tracked
+	LineCounterLength int
+}
+
+// LineExplanation describes how a line of the generated yolol-code has been created
+type LineExplanation struct {
+	// the positions of the nolol-lines that have been merged into this line
+	Sources []ast.Position
+	// the length of the line, as estimated during merging. Gotos to labels count as 7 characters and the line-counter is not included
+	Length int
+	// why the next line has not been merged into this one. Empty for the last line
+	Reason string
+}
+
+// GetExplanations returns how the lines of the generated programs have been created (one entry per chip).
+// If the conversion failed while merging lines, the explanation of the failing chip ends with the line that could not be converted
+func (c *Converter) GetExplanations() []*Explanation {
+	return c.explanations
+}
+
+// explainLine records a new line in the given explanation. Returns nil if no explanation is recorded
+func (c *Converter) explainLine(explanation *Explanation, source *nast.StatementLine) *LineExplanation {
+	if explanation == nil {
+		return nil
+	}
+	line := &LineExplanation{}
+	explanation.Lines = append(explanation.Lines, line)
+	c.explainSource(line, source)
+	return line
+}
+
+// explainSource records that the given nolol-line has been merged into the line. Lines without statements are ignored
+func (c *Converter) explainSource(line *LineExplanation, source *nast.StatementLine) {
+	if line == nil || len(source.Statements) == 0 {
+		return
+	}
+	pos := source.Start()
+	pos.File = c.sourceName(pos)
+	line.Sources = append(line.Sources, pos)
+}
+
+// mergeBreakReason describes why next has not been merged into the line that ends with last
+func mergeBreakReason(last *nast.StatementLine, next *nast.StatementLine, length int, maxlen int) string {
+	nextlen := getLengthOfLine(&next.Line)
+	switch {
+	case isWaitLine(last):
+		return "The line ends with a wait-directive"
+	case isWaitLine(next):
+		return "The next line is a wait-directive"
+	case last.Raw && last.HasEOL:
+		return "The line ends with a line of a yolol-block"
+	case next.Raw && next.HasBOL:
+		return "The next line is a line of a yolol-block"
+	case last.HasEOL:
+		return "The line ends with '$'"
+	case next.HasBOL:
+		return "The next line starts with '$'"
+	case next.PinnedLine != 0:
+		return fmt.Sprintf("The next line is pinned to line %d", next.PinnedLine)
+	case next.Label != "":
+		return fmt.Sprintf("The next line has the label '%s'", next.Label)
+	}
+	return fmt.Sprintf("The next line does not fit (%d + %d > %d characters)", length, nextlen, maxlen)
+}
+
+// isWaitLine checks if the given line has been generated by a wait-directive (label> if cond then goto label end).
+// Waits with then- or else-blocks nest the goto into the if-block
+func isWaitLine(line *nast.StatementLine) bool {
+	if line.Label == "" || len(line.Statements) == 0 {
+		return false
+	}
+	stmts := line.Statements
+	for len(stmts) > 0 {
+		ifstmt, isif := stmts[0].(*ast.IfStatement)
+		if !isif || len(ifstmt.IfBlock) == 0 {
+			return false
+		}
+		gotostmt, isgoto := ifstmt.IfBlock[0].(*nast.GoToLabelStatement)
+		if isgoto {
+			return gotostmt.Label == line.Label
+		}
+		stmts = ifstmt.IfBlock
+	}
+	return false
+}
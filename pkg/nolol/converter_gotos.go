@@ -8,6 +8,7 @@ import (
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
 	"github.com/dbaumgarten/yodk/pkg/parser"
 	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
 // getJumpLabel is a case-insensitive getter for c.jumpLabels
@@ -34,6 +35,14 @@ func (c *Converter) removeDuplicateGotos(p ast.Node) error {
 			}
 			lastWasGoto = true
 			break
+		case *nast.DynamicGoToStatement:
+			if visitType == ast.PreVisit && lastWasGoto {
+				return ast.NewNodeReplacement()
+			}
+			if visitType == ast.PostVisit {
+				lastWasGoto = true
+			}
+			return nil
 		case *nast.StatementLine:
 			if visitType == ast.PreVisit && n.Label != "" {
 				lastWasGoto = false
@@ -56,6 +65,12 @@ func (c *Converter) removeUnusedLabels(p *nast.Program) error {
 		if gotostmt, isGoto := node.(*nast.GoToLabelStatement); isGoto {
 			used[gotostmt.Label] = true
 		}
+		// the labels of dynamic gotos must be kept, as their line-numbers are needed at runtime
+		if gotostmt, isGoto := node.(*nast.DynamicGoToStatement); isGoto {
+			for _, label := range gotostmt.Labels {
+				used[label] = true
+			}
+		}
 		return nil
 	}
 	err := p.Accept(ast.VisitorFunc(f))
@@ -64,7 +79,8 @@ func (c *Converter) removeUnusedLabels(p *nast.Program) error {
 	}
 	for _, element := range p.Elements {
 		if line, isLine := element.(*nast.StatementLine); isLine {
-			if _, isused := used[line.Label]; !isused {
+			// pinned lines are jumped to by their line-number (for example from other chips). Their labels must be kept
+			if _, isused := used[line.Label]; !isused && line.PinnedLine == 0 {
 				line.Label = ""
 			}
 		}
@@ -106,6 +122,14 @@ func (c *Converter) resolveGotoChains(p *nast.Program) error {
 				gotostmt.Label = targetgoto.Label
 			}
 		}
+		if gotostmt, isGoto := node.(*nast.DynamicGoToStatement); isGoto && visitType == ast.PreVisit {
+			for i, label := range gotostmt.Labels {
+				targetgoto := getTargetGoto(label)
+				if targetgoto != nil {
+					gotostmt.Labels[i] = targetgoto.Label
+				}
+			}
+		}
 		return nil
 	}
 	return p.Accept(ast.VisitorFunc(f))
@@ -130,8 +154,8 @@ func (c *Converter) findJumpLabels(p ast.Node) error {
 					}
 					c.setJumpLabel(line.Label, linecounter)
 				}
-				// remove all empty lines
-				if len(line.Statements) == 0 && !line.HasEOL {
+				// remove all empty lines. Pinned lines must be kept, even if they are empty
+				if len(line.Statements) == 0 && !line.HasEOL && line.PinnedLine == 0 {
 					linecounter--
 					return ast.NewNodeReplacement()
 				}
@@ -142,6 +166,48 @@ func (c *Converter) findJumpLabels(p ast.Node) error {
 	return p.Accept(ast.VisitorFunc(f))
 }
 
+// pinLines inserts empty lines in front of pinned lines, so that every pinned line is placed at its line-number.
+// Must be called after findJumpLabels, as the inserted lines must not be removed as empty lines.
+// The inserted lines are also recorded in the given explanation
+func (c *Converter) pinLines(p *nast.Program, explanation *Explanation) error {
+	elements := make([]nast.Element, 0, len(p.Elements))
+	lines := make([]*LineExplanation, 0, len(explanation.Lines))
+	for i, element := range p.Elements {
+		line := element.(*nast.StatementLine)
+		if line.PinnedLine != 0 {
+			if len(elements)+1 > line.PinnedLine {
+				return &parser.Error{
+					Message:       fmt.Sprintf("The line with the label '%s' can not be placed at line %d. The code before it needs %d lines", line.Label, line.PinnedLine, len(elements)),
+					StartPosition: line.Start(),
+					EndPosition:   line.Start(),
+				}
+			}
+			for len(elements)+1 < line.PinnedLine {
+				elements = append(elements, &nast.StatementLine{
+					Position: line.Position,
+					HasEOL:   true,
+					Line: ast.Line{
+						Position:   line.Position,
+						Statements: []ast.Statement{},
+					},
+				})
+				lines = append(lines, &LineExplanation{
+					Reason: fmt.Sprintf("Empty line to place the label '%s' at line %d", line.Label, line.PinnedLine),
+				})
+			}
+		}
+		elements = append(elements, element)
+		lines = append(lines, explanation.Lines[i])
+	}
+	if len(elements) == len(p.Elements) {
+		return nil
+	}
+	p.Elements = elements
+	explanation.Lines = lines
+	// the labels have moved
+	return c.findJumpLabels(p)
+}
+
 // replaceGotoLabels replaces all goto labels with the appropriate line-number
 func (c *Converter) replaceGotoLabels(p ast.Node) error {
 	f := func(node ast.Node, visitType int) error {
@@ -163,7 +229,114 @@ func (c *Converter) replaceGotoLabels(p ast.Node) error {
 			}
 			return ast.NewNodeReplacement(repl)
 		}
+		if gotostmt, is := node.(*nast.DynamicGoToStatement); is && visitType == ast.PreVisit {
+			lines := make([]int, len(gotostmt.Labels))
+			for i, label := range gotostmt.Labels {
+				line, exists := c.getJumpLabel(label)
+				if !exists {
+					return &parser.Error{
+						Message:       "Unknown jump-label: " + label,
+						StartPosition: gotostmt.Start(),
+						EndPosition:   gotostmt.End(),
+					}
+				}
+				lines[i] = line
+			}
+			return ast.NewNodeReplacementSkip(dynamicGotoToYolol(gotostmt, lines))
+		}
 		return nil
 	}
 	return p.Accept(ast.VisitorFunc(f))
 }
+
+// convertDynamicGoto checks the index of a dynamic goto.
+// If the index is known at compile-time, the dynamic goto is replaced by a normal goto
+func (c *Converter) convertDynamicGoto(gotostmt *nast.DynamicGoToStatement) error {
+	gotostmt.Index = c.sexpOptimizer.OptimizeExpression(gotostmt.Index)
+	switch index := gotostmt.Index.(type) {
+	case *ast.StringConstant:
+		return &parser.Error{
+			Message:       "The index of a dynamic goto must be a number",
+			StartPosition: index.Start(),
+			EndPosition:   index.End(),
+		}
+	case *ast.NumberConstant:
+		i := vm.VariableFromString(index.Value).Number()
+		if !i.Truncate(0).Equal(i) || i.IntPart() < 0 || i.IntPart() >= int64(len(gotostmt.Labels)) {
+			return &parser.Error{
+				Message:       fmt.Sprintf("The index of the dynamic goto is out of range: %s", index.Value),
+				StartPosition: index.Start(),
+				EndPosition:   index.End(),
+			}
+		}
+		return ast.NewNodeReplacementSkip(&nast.GoToLabelStatement{
+			Position: gotostmt.Position,
+			Label:    gotostmt.Labels[i.IntPart()],
+		})
+	}
+
+	// the index is evaluated once for every label
+	hasSideEffects := false
+	gotostmt.Index.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && deref.Operator != "" {
+			hasSideEffects = true
+		}
+		return nil
+	}))
+	if hasSideEffects {
+		return &parser.Error{
+			Message:       "The index of a dynamic goto must not use ++ or --",
+			StartPosition: gotostmt.Index.Start(),
+			EndPosition:   gotostmt.Index.End(),
+		}
+	}
+	return nil
+}
+
+// dynamicGotoToYolol converts a dynamic goto into a yolol-goto with a computed line-number
+// lines contains the line-numbers of the labels of the dynamic goto.
+// The generated expression looks like this: goto line0+(index==1)*(line1-line0)+(index==2)*(line2-line0)...
+func dynamicGotoToYolol(gotostmt *nast.DynamicGoToStatement, lines []int) *ast.GoToStatement {
+	var target ast.Expression = &ast.NumberConstant{
+		Position: gotostmt.Position,
+		Value:    strconv.Itoa(lines[0]),
+	}
+	for i := 1; i < len(lines); i++ {
+		diff := lines[i] - lines[0]
+		if diff == 0 {
+			continue
+		}
+		operator := "+"
+		if diff < 0 {
+			operator = "-"
+			diff = -diff
+		}
+		var offset ast.Expression = &ast.BinaryOperation{
+			Operator: "==",
+			Exp1:     nast.CopyAst(gotostmt.Index).(ast.Expression),
+			Exp2: &ast.NumberConstant{
+				Position: gotostmt.Position,
+				Value:    strconv.Itoa(i),
+			},
+		}
+		if diff != 1 {
+			offset = &ast.BinaryOperation{
+				Operator: "*",
+				Exp1:     offset,
+				Exp2: &ast.NumberConstant{
+					Position: gotostmt.Position,
+					Value:    strconv.Itoa(diff),
+				},
+			}
+		}
+		target = &ast.BinaryOperation{
+			Operator: operator,
+			Exp1:     target,
+			Exp2:     offset,
+		}
+	}
+	return &ast.GoToStatement{
+		Position: gotostmt.Position,
+		Line:     target,
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
 	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
 // special error that is emitted if a nolol if can not be converted to an inline yolol-if
@@ -12,6 +13,17 @@ var errInlineIfImpossible = fmt.Errorf("Can not convert to inline if")
 
 // convertIf converts nolol multiline-ifs to yolol
 func (c *Converter) convertIf(mlif *nast.MultilineIf) error {
+	c.removeConstantConditions(mlif)
+	if len(mlif.Conditions) == 0 {
+		repl := []ast.Node{}
+		if mlif.ElseBlock != nil {
+			for _, elseline := range mlif.ElseBlock.Elements {
+				repl = append(repl, elseline)
+			}
+		}
+		return ast.NewNodeReplacementSkip(repl...)
+	}
+
 	endif := fmt.Sprintf("endif%d", c.iflabelcounter)
 	repl := []ast.Node{}
 	for i := range mlif.Conditions {
@@ -46,6 +58,53 @@ func (c *Converter) convertIf(mlif *nast.MultilineIf) error {
 	return ast.NewNodeReplacementSkip(repl...)
 }
 
+// removeConstantConditions removes the blocks of the if, whose conditions are known at compile-time.
+// A block whose condition is always true becomes the else-block. Blocks containing labels are never removed.
+func (c *Converter) removeConstantConditions(mlif *nast.MultilineIf) {
+	for i := 0; i < len(mlif.Conditions); i++ {
+		constant, isconst := mlif.Conditions[i].(*ast.NumberConstant)
+		if !isconst {
+			continue
+		}
+		if vm.VariableFromString(constant.Value).Number().IsZero() {
+			if hasLabels(mlif.Blocks[i]) {
+				continue
+			}
+			mlif.Conditions = append(mlif.Conditions[:i], mlif.Conditions[i+1:]...)
+			mlif.Blocks = append(mlif.Blocks[:i], mlif.Blocks[i+1:]...)
+			mlif.Positions = append(mlif.Positions[:i], mlif.Positions[i+1:]...)
+			i--
+			continue
+		}
+		// the following blocks are never executed
+		for _, block := range mlif.Blocks[i+1:] {
+			if hasLabels(block) {
+				return
+			}
+		}
+		if mlif.ElseBlock != nil && hasLabels(mlif.ElseBlock) {
+			return
+		}
+		mlif.ElseBlock = mlif.Blocks[i]
+		mlif.Conditions = mlif.Conditions[:i]
+		mlif.Blocks = mlif.Blocks[:i]
+		mlif.Positions = mlif.Positions[:i]
+		return
+	}
+}
+
+// hasLabels returns true if the given block contains a labeled line
+func hasLabels(block *nast.Block) bool {
+	found := false
+	block.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if line, isline := node.(*nast.StatementLine); isline && line.Label != "" {
+			found = true
+		}
+		return nil
+	}))
+	return found
+}
+
 // convertConditionInline converts a single conditional block of a multiline if and tries to produce a single yolol if
 func (c *Converter) convertConditionInline(mlif *nast.MultilineIf, index int, endlabel string) (ast.Node, error) {
 	mergedIfElements, _ := c.mergeNololNestableElements(mlif.Blocks[index].Elements)
@@ -98,7 +157,7 @@ func (c *Converter) convertConditionInline(mlif *nast.MultilineIf, index int, en
 // multiple lines, because a single-line if would become too long
 func (c *Converter) convertConditionMultiline(mlif *nast.MultilineIf, index int, endlabel string) []ast.Node {
 	skipIf := fmt.Sprintf("iflbl%d-%d", c.iflabelcounter, index)
-	condition := c.boolexpOptimizer.OptimizeExpression(&ast.UnaryOperation{
+	condition := c.optimizeInversion(&ast.UnaryOperation{
 		Operator: "not",
 		Exp:      mlif.Conditions[index],
 	})
@@ -2,28 +2,74 @@ package nolol
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/nolol/stdlib"
 	"github.com/dbaumgarten/yodk/pkg/parser"
 	"github.com/dbaumgarten/yodk/pkg/parser/ast"
 )
 
+// SetIncludePaths sets a list of directories that are searched for included files,
+// if the file can not be found relative to the including file
+func (c *Converter) SetIncludePaths(dirs []string) {
+	c.includePaths = dirs
+}
+
+// getFile returns the content of the given file. If the file can not be found, the include-paths are searched.
+// Files starting with "std/" are served from the standard-library
+func (c *Converter) getFile(name string) (string, error) {
+	if stdlib.IsStdlib(name) {
+		return stdlib.Get(name)
+	}
+	file, err := c.files.Get(name)
+	if err == nil {
+		return file, nil
+	}
+	for _, dir := range c.includePaths {
+		content, searchErr := DiskFileSystem{Dir: dir}.Get(name)
+		if searchErr == nil {
+			return content, nil
+		}
+	}
+	return "", err
+}
+
 // resolveIncludes searches for include-directives and inserts the lines of the included files
 func (c *Converter) convertInclude(include *nast.IncludeDirective) error {
+	parsed, err := c.loadInclude(include)
+	if err != nil {
+		return err
+	}
+
+	if usesTimeTracking(parsed) {
+		c.usesTimeTracking = true
+	}
+
+	replacements := make([]ast.Node, len(parsed.Elements))
+	for i := range parsed.Elements {
+		replacements[i] = parsed.Elements[i]
+	}
+	return ast.NewNodeReplacement(replacements...)
+}
+
+// loadInclude loads and parses the file of an include-directive.
+// If the include has a namespace, all includes of the file are resolved and the definitions and macros of the file are moved into the namespace
+func (c *Converter) loadInclude(include *nast.IncludeDirective) (*nast.Program, error) {
 	p := NewParser()
 
 	c.includecount++
 	if c.includecount > 20 {
-		return &parser.Error{
+		return nil, &parser.Error{
 			Message:       "Error when processing includes: Include-loop detected",
 			StartPosition: ast.NewPosition("", 1, 1),
 			EndPosition:   ast.NewPosition("", 20, 70),
 		}
 	}
 
-	file, err := c.files.Get(include.File)
+	file, err := c.getFile(include.File)
 	if err != nil {
-		return &parser.Error{
+		return nil, &parser.Error{
 			Message:       fmt.Sprintf("Error when opening included file '%s': %s", include.File, err.Error()),
 			StartPosition: include.Start(),
 			EndPosition:   include.End(),
@@ -35,20 +81,114 @@ func (c *Converter) convertInclude(include *nast.IncludeDirective) error {
 		// override the position of the error with the position of the include
 		// this way the error gets displayed at the correct location
 		// the message does contain the original location
-		return &parser.Error{
+		return nil, &parser.Error{
 			Message:       err.Error(),
 			StartPosition: include.Start(),
 			EndPosition:   include.End(),
 		}
 	}
 
-	if usesTimeTracking(parsed) {
-		c.usesTimeTracking = true
+	// every included file gets its own names for block-locals. Top-level locals of the file live until the end of the program
+	err = c.resolveLocals(parsed, fmt.Sprintf("_include%d%s", c.includecount, localPrefix))
+	if err != nil {
+		return nil, err
 	}
 
-	replacements := make([]ast.Node, len(parsed.Elements))
-	for i := range parsed.Elements {
-		replacements[i] = parsed.Elements[i]
+	if include.Namespace == "" {
+		return parsed, nil
 	}
-	return ast.NewNodeReplacement(replacements...)
+
+	// the names declared by nested includes must also be moved into the namespace
+	err = c.expandIncludes(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	qualifyNames(parsed, include.Namespace)
+	return parsed, nil
+}
+
+// expandIncludes replaces all includes in the given program by the contents of the included files
+func (c *Converter) expandIncludes(prog *nast.Program) error {
+	return prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if include, isinclude := node.(*nast.IncludeDirective); isinclude {
+			parsed, err := c.loadInclude(include)
+			if err != nil {
+				return err
+			}
+			err = c.expandIncludes(parsed)
+			if err != nil {
+				return err
+			}
+			replacements := make([]ast.Node, len(parsed.Elements))
+			for i := range parsed.Elements {
+				replacements[i] = parsed.Elements[i]
+			}
+			return ast.NewNodeReplacementSkip(replacements...)
+		}
+		return nil
+	}))
+}
+
+// qualifyNames prefixes all definitions and macros declared in prog (and all references to them) with the given namespace
+func qualifyNames(prog *nast.Program, namespace string) {
+	definitions := make(map[string]bool)
+	macros := make(map[string]bool)
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *nast.Definition:
+			definitions[strings.ToLower(n.Name)] = true
+		case *nast.MacroDefinition:
+			macros[strings.ToLower(n.Name)] = true
+		}
+		return nil
+	}))
+
+	qualify := func(name string) string {
+		return namespace + "." + name
+	}
+
+	// inside of macros, the arguments hide definitions with the same name
+	arguments := make([]map[string]bool, 0)
+	isDefinition := func(name string) bool {
+		name = strings.ToLower(name)
+		if len(arguments) > 0 && arguments[len(arguments)-1][name] {
+			return false
+		}
+		return definitions[name]
+	}
+
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *nast.Definition:
+			if visitType == ast.PreVisit {
+				n.Name = qualify(n.Name)
+			}
+		case *nast.MacroDefinition:
+			if visitType == ast.PreVisit {
+				n.Name = qualify(n.Name)
+				args := make(map[string]bool)
+				for _, arg := range n.Arguments {
+					args[strings.ToLower(arg)] = true
+				}
+				arguments = append(arguments, args)
+			} else if visitType == ast.PostVisit {
+				arguments = arguments[:len(arguments)-1]
+			}
+		case *nast.FuncCall:
+			// covers insertions of macros as well as calls of expression-macros
+			if visitType == ast.PreVisit && macros[strings.ToLower(n.Function)] && !isBuiltinFunction(n.Function) {
+				n.Function = qualify(n.Function)
+			}
+		case *ast.Dereference:
+			if isDefinition(n.Variable) {
+				n.Variable = qualify(n.Variable)
+			}
+		case *ast.Assignment:
+			if visitType == ast.PreVisit && isDefinition(n.Variable) {
+				n.Variable = qualify(n.Variable)
+			}
+		}
+		return nil
+	}))
 }
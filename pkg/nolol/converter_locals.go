@@ -0,0 +1,140 @@
+package nolol
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// localPrefix is the prefix for the internal names of block-local variables of the main-file
+const localPrefix = "_local"
+
+// localScope contains the local variables that have been declared inside of a block
+type localScope struct {
+	// maps the lowercased name of a local variable to its internal name
+	names map[string]string
+	// the number of local variables that have been alive when the block was entered
+	base int
+	// if set, the scope is the boundary of a macro-definition. Locals of outer blocks are not visible inside of macros
+	macro *nast.MacroDefinition
+}
+
+// resolveLocals gives every block-local variable a unique internal name and replaces the local-declarations by assignments.
+// The internal name of a local is made of the given prefix and the number of locals that are alive at its declaration.
+// Locals with lifetimes that do not overlap therefore end up with the same internal name (and the same short yolol-name)
+func (c *Converter) resolveLocals(prog *nast.Program, prefix string) error {
+	scopes := []localScope{}
+	alive := 0
+
+	push := func(macro *nast.MacroDefinition) {
+		scopes = append(scopes, localScope{
+			names: make(map[string]string),
+			base:  alive,
+			macro: macro,
+		})
+	}
+
+	lookup := func(name string) (string, bool) {
+		name = strings.ToLower(name)
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if internal, exists := scopes[i].names[name]; exists {
+				return internal, true
+			}
+			if scopes[i].macro != nil {
+				break
+			}
+		}
+		return "", false
+	}
+
+	return prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *nast.Program:
+			if visitType == ast.PreVisit {
+				push(nil)
+			}
+		case *nast.MacroDefinition:
+			if visitType == ast.PreVisit {
+				push(n)
+				// inside of macros, the numbering starts again. The locals are scoped to the insertion anyway
+				alive = 0
+			} else if visitType == ast.PostVisit {
+				alive = scopes[len(scopes)-1].base
+				scopes = scopes[:len(scopes)-1]
+			}
+		case *nast.Block:
+			if visitType == ast.PreVisit {
+				push(nil)
+			} else if visitType == ast.PostVisit {
+				scope := scopes[len(scopes)-1]
+				scopes = scopes[:len(scopes)-1]
+				alive = scope.base
+				// the result of a macro can be a local variable of the macro-body
+				parent := scopes[len(scopes)-1]
+				if parent.macro != nil && parent.macro.Result != "" {
+					if internal, exists := scope.names[strings.ToLower(parent.macro.Result)]; exists {
+						parent.macro.Result = internal
+					}
+				}
+			}
+		case *nast.LocalDeclaration:
+			// the value is visited before the declaration. "local x = x" initializes the local with the value of the outer x
+			if visitType == ast.PostVisit {
+				scope := scopes[len(scopes)-1]
+				name := strings.ToLower(n.Name)
+				if _, exists := scope.names[name]; exists {
+					return &parser.Error{
+						Message:       fmt.Sprintf("The local variable '%s' has already been declared in this block", n.Name),
+						StartPosition: n.Start(),
+						EndPosition:   n.End(),
+					}
+				}
+				internal := fmt.Sprintf("%s%d", prefix, alive)
+				alive++
+				scope.names[name] = internal
+				// the variable may have been used by a previous local. Without an explicit value, it is initialized with 0
+				value := n.Value
+				if value == nil {
+					value = &ast.NumberConstant{
+						Position: n.Position,
+						Value:    "0",
+					}
+				}
+				return ast.NewNodeReplacementSkip(&nast.StatementLine{
+					Position: n.Position,
+					Line: ast.Line{
+						Position: n.Position,
+						Statements: []ast.Statement{
+							&ast.Assignment{
+								Position: n.Position,
+								Variable: internal,
+								Operator: "=",
+								Value:    value,
+							},
+						},
+					},
+				})
+			}
+		case *ast.Assignment:
+			if visitType == ast.PreVisit {
+				if internal, exists := lookup(n.Variable); exists {
+					n.Variable = internal
+				}
+			}
+		case *ast.Dereference:
+			if internal, exists := lookup(n.Variable); exists {
+				n.Variable = internal
+			}
+		case *nast.ForLoop:
+			if visitType == ast.PreVisit {
+				if internal, exists := lookup(n.Variable); exists {
+					n.Variable = internal
+				}
+			}
+		}
+		return nil
+	}))
+}
@@ -2,6 +2,7 @@ package nolol
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
 	"github.com/dbaumgarten/yodk/pkg/parser"
@@ -9,16 +10,85 @@ import (
 	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
-// getCurrentLoopNumber returns the number of the current (innermost) loop that is beeing converted
-func (c *Converter) getCurrentLoopNumber() int {
+// loopScope describes a loop that is currently being converted
+type loopScope struct {
+	// the label given to the loop in the source-code. Empty if the loop has none
+	Label string
+	// the line-label at the beginning of the loop
+	StartLabel string
+	// the line-label break jumps to
+	BreakLabel string
+	// the line-label continue jumps to
+	ContinueLabel string
+}
+
+// enterWhileLoop is called before the contents of a while-loop are converted.
+// When optimizing for speed, the condition is checked at the end of the loop and continue jumps there
+func (c *Converter) enterWhileLoop(loop *nast.WhileLoop) {
+	c.loopcounter++
+	continueLabel := fmt.Sprintf("while%d", c.loopcounter)
+	if c.level == OptimizeSpeed {
+		continueLabel = fmt.Sprintf("whilecondition%d", c.loopcounter)
+	}
+	c.loopLevel = append(c.loopLevel, loopScope{
+		Label:         loop.Label,
+		StartLabel:    fmt.Sprintf("while%d", c.loopcounter),
+		BreakLabel:    fmt.Sprintf("endwhile%d", c.loopcounter),
+		ContinueLabel: continueLabel,
+	})
+}
+
+// enterDoWhileLoop is called before the contents of a do-while-loop are converted.
+// Continue jumps to the check of the condition
+func (c *Converter) enterDoWhileLoop(loop *nast.DoWhileLoop) {
+	c.loopcounter++
+	c.loopLevel = append(c.loopLevel, loopScope{
+		Label:         loop.Label,
+		StartLabel:    fmt.Sprintf("do%d", c.loopcounter),
+		BreakLabel:    fmt.Sprintf("enddo%d", c.loopcounter),
+		ContinueLabel: fmt.Sprintf("docondition%d", c.loopcounter),
+	})
+}
+
+// leaveLoop is called after a loop has been converted
+func (c *Converter) leaveLoop() {
+	c.loopLevel = c.loopLevel[:len(c.loopLevel)-1]
+}
+
+// getCurrentLoop returns the current (innermost) loop that is beeing converted
+func (c *Converter) getCurrentLoop() loopScope {
 	return c.loopLevel[len(c.loopLevel)-1]
 }
 
+// findLoop returns the loop a break or continue with the given label refers to.
+// If label is empty, the innermost loop is returned
+func (c *Converter) findLoop(label string, keyword string, node ast.Node) (loopScope, error) {
+	if len(c.loopLevel) == 0 {
+		return loopScope{}, &parser.Error{
+			Message:       fmt.Sprintf("The %s keyword can only be used inside loops", keyword),
+			StartPosition: node.Start(),
+			EndPosition:   node.End(),
+		}
+	}
+	if label == "" {
+		return c.getCurrentLoop(), nil
+	}
+	for i := len(c.loopLevel) - 1; i >= 0; i-- {
+		if c.loopLevel[i].Label == label {
+			return c.loopLevel[i], nil
+		}
+	}
+	return loopScope{}, &parser.Error{
+		Message:       fmt.Sprintf("There is no loop labeled '%s' around this %s", label, keyword),
+		StartPosition: node.Start(),
+		EndPosition:   node.End(),
+	}
+}
+
 // convertWhileLoop converts while loops into yolol-code
 func (c *Converter) convertWhileLoop(loop *nast.WhileLoop) error {
-	loopnr := c.getCurrentLoopNumber()
-	startLabel := fmt.Sprintf("while%d", loopnr)
-	endLabel := fmt.Sprintf("endwhile%d", loopnr)
+	startLabel := c.getCurrentLoop().StartLabel
+	endLabel := c.getCurrentLoop().BreakLabel
 
 	repl := []ast.Node{
 		&nast.StatementLine{
@@ -37,13 +107,19 @@ func (c *Converter) convertWhileLoop(loop *nast.WhileLoop) error {
 		variable := vm.VariableFromString(numberconst.Value)
 		if !variable.Number().IsZero() {
 			conditionIsAlwaysTrue = true
+		} else {
+			c.warn("The condition of this loop is always false. The loop is never executed", loop.Condition.Start(), loop.Condition.End())
 		}
 	}
 
+	if c.level == OptimizeSpeed && !conditionIsAlwaysTrue {
+		return c.convertRotatedWhileLoop(loop, condition)
+	}
+
 	// if the condition is always true, we do not need to add a condition-check
 	// this makes infinite loops smaller
 	if !conditionIsAlwaysTrue {
-		condition = c.boolexpOptimizer.OptimizeExpression(&ast.UnaryOperation{
+		condition = c.optimizeInversion(&ast.UnaryOperation{
 			Operator: "not",
 			Exp:      condition,
 			Position: condition.Start(),
@@ -66,7 +142,7 @@ func (c *Converter) convertWhileLoop(loop *nast.WhileLoop) error {
 	for _, blockline := range loop.Block.Elements {
 		repl = append(repl, blockline)
 	}
-	repl = append(repl, &nast.StatementLine{
+	jumpBack := &nast.StatementLine{
 		Position: loop.Block.End(),
 		Line: ast.Line{
 			Statements: []ast.Statement{
@@ -76,8 +152,87 @@ func (c *Converter) convertWhileLoop(loop *nast.WhileLoop) error {
 				},
 			},
 		},
+	}
+	// when optimizing for speed, continue always jumps to the end of the loop
+	if c.getCurrentLoop().ContinueLabel != startLabel {
+		jumpBack.Label = c.getCurrentLoop().ContinueLabel
+	}
+	repl = append(repl, jumpBack)
+
+	repl = append(repl, &nast.StatementLine{
+		Position: loop.Position,
+		Label:    endLabel,
+		Line: ast.Line{
+			Statements: []ast.Statement{},
+		},
+	})
+
+	return ast.NewNodeReplacementSkip(repl...)
+
+}
+
+// convertRotatedWhileLoop converts a while-loop into code that checks the condition once before the loop and then at the end of every iteration.
+// Compared to jumping back to the check at the beginning, this duplicates the condition, but the check at the end
+// can share the line with the last statements of the loop
+func (c *Converter) convertRotatedWhileLoop(loop *nast.WhileLoop, condition ast.Expression) error {
+	startLabel := c.getCurrentLoop().StartLabel
+	conditionLabel := c.getCurrentLoop().ContinueLabel
+	endLabel := c.getCurrentLoop().BreakLabel
+
+	repeat := nast.CopyAst(condition).(ast.Expression)
+	skip := c.optimizeInversion(&ast.UnaryOperation{
+		Operator: "not",
+		Exp:      condition,
+		Position: condition.Start(),
 	})
 
+	repl := []ast.Node{
+		&nast.StatementLine{
+			Position: loop.Position,
+			Line: ast.Line{
+				Statements: []ast.Statement{
+					&ast.IfStatement{
+						Position:  loop.Condition.Start(),
+						Condition: skip,
+						IfBlock: []ast.Statement{
+							&nast.GoToLabelStatement{
+								Position: loop.Position,
+								Label:    endLabel,
+							},
+						},
+					},
+				},
+			},
+		},
+		&nast.StatementLine{
+			Position: loop.Position,
+			Label:    startLabel,
+			Line: ast.Line{
+				Statements: []ast.Statement{},
+			},
+		},
+	}
+	for _, blockline := range loop.Block.Elements {
+		repl = append(repl, blockline)
+	}
+	repl = append(repl, &nast.StatementLine{
+		Position: loop.Block.End(),
+		Label:    conditionLabel,
+		Line: ast.Line{
+			Statements: []ast.Statement{
+				&ast.IfStatement{
+					Position:  loop.Condition.Start(),
+					Condition: repeat,
+					IfBlock: []ast.Statement{
+						&nast.GoToLabelStatement{
+							Position: loop.Block.End(),
+							Label:    startLabel,
+						},
+					},
+				},
+			},
+		},
+	})
 	repl = append(repl, &nast.StatementLine{
 		Position: loop.Position,
 		Label:    endLabel,
@@ -87,37 +242,307 @@ func (c *Converter) convertWhileLoop(loop *nast.WhileLoop) error {
 	})
 
 	return ast.NewNodeReplacementSkip(repl...)
+}
+
+// convertDoWhileLoop converts a do-while-loop into yolol-code.
+// The condition is checked at the end of the loop using a single conditional goto
+func (c *Converter) convertDoWhileLoop(loop *nast.DoWhileLoop) error {
+	startLabel := c.getCurrentLoop().StartLabel
+	conditionLabel := c.getCurrentLoop().ContinueLabel
+	endLabel := c.getCurrentLoop().BreakLabel
+
+	repl := []ast.Node{
+		&nast.StatementLine{
+			Position: loop.Position,
+			Label:    startLabel,
+			Line: ast.Line{
+				Statements: []ast.Statement{},
+			},
+		},
+	}
+	for _, blockline := range loop.Block.Elements {
+		repl = append(repl, blockline)
+	}
 
+	condition := c.sexpOptimizer.OptimizeExpression(loop.Condition)
+	var check ast.Statement = &nast.GoToLabelStatement{
+		Position: loop.Condition.Start(),
+		Label:    startLabel,
+	}
+	if numberconst, is := condition.(*ast.NumberConstant); !is {
+		check = &ast.IfStatement{
+			Position:  loop.Condition.Start(),
+			Condition: condition,
+			IfBlock:   []ast.Statement{check},
+		}
+	} else if vm.VariableFromString(numberconst.Value).Number().IsZero() {
+		// the block is executed exactly once
+		check = nil
+	}
+
+	conditionLine := &nast.StatementLine{
+		Position: loop.Condition.Start(),
+		Label:    conditionLabel,
+		Line: ast.Line{
+			Statements: []ast.Statement{},
+		},
+	}
+	if check != nil {
+		conditionLine.Statements = append(conditionLine.Statements, check)
+	}
+	repl = append(repl, conditionLine)
+
+	repl = append(repl, &nast.StatementLine{
+		Position: loop.End(),
+		Label:    endLabel,
+		Line: ast.Line{
+			Statements: []ast.Statement{},
+		},
+	})
+
+	return ast.NewNodeReplacementSkip(repl...)
 }
 
 // convertBreakStatement converts the rbeak keyword
 func (c *Converter) convertBreakStatement(brk *nast.BreakStatement) error {
-	if len(c.loopLevel) == 0 {
-		return &parser.Error{
-			Message:       "The break keyword can only be used inside loops",
-			StartPosition: brk.Start(),
-			EndPosition:   brk.End(),
-		}
+	loop, err := c.findLoop(brk.Label, "break", brk)
+	if err != nil {
+		return err
 	}
-	endLabel := fmt.Sprintf("endwhile%d", c.getCurrentLoopNumber())
 	return ast.NewNodeReplacementSkip(&nast.GoToLabelStatement{
 		Position: brk.Position,
-		Label:    endLabel,
+		Label:    loop.BreakLabel,
 	})
 }
 
 // convertContinueStatement converts the continue keyword
 func (c *Converter) convertContinueStatement(cnt *nast.ContinueStatement) error {
-	if len(c.loopLevel) == 0 {
-		return &parser.Error{
-			Message:       "The continue keyword can only be used inside loops",
-			StartPosition: cnt.Start(),
-			EndPosition:   cnt.End(),
-		}
+	loop, err := c.findLoop(cnt.Label, "continue", cnt)
+	if err != nil {
+		return err
 	}
-	startLabel := fmt.Sprintf("while%d", c.getCurrentLoopNumber())
 	return ast.NewNodeReplacementSkip(&nast.GoToLabelStatement{
 		Position: cnt.Position,
-		Label:    startLabel,
+		Label:    loop.ContinueLabel,
 	})
 }
+
+// maxUnrolledIterations is the maximum number of iterations a for-loop can be unrolled to
+const maxUnrolledIterations = 100
+
+// convertForLoop converts a for-loop. If both bounds are known at compile-time, the loop is unrolled.
+// Otherwise it is converted to a counting while-loop.
+func (c *Converter) convertForLoop(loop *nast.ForLoop) error {
+	from := c.staticValue(loop.From)
+	to := c.staticValue(loop.To)
+	if isConstant(from) && isConstant(to) {
+		return c.unrollForLoop(loop, constantValue(from), constantValue(to))
+	}
+
+	// i = from-1; while ++i<=to do ... end
+	// incrementing inside the condition makes sure that continue also increments the variable
+	start := &ast.Assignment{
+		Position: loop.Position,
+		Variable: loop.Variable,
+		Operator: "=",
+		Value: &ast.BinaryOperation{
+			Operator: "-",
+			Exp1:     loop.From,
+			Exp2: &ast.NumberConstant{
+				Position: loop.From.Start(),
+				Value:    "1",
+			},
+		},
+	}
+	while := &nast.WhileLoop{
+		Position: loop.Position,
+		Label:    loop.Label,
+		Condition: &ast.BinaryOperation{
+			Operator: "<=",
+			Exp1: &ast.Dereference{
+				Position: loop.Position,
+				Variable: loop.Variable,
+				Operator: "++",
+				PrePost:  "Pre",
+			},
+			Exp2: loop.To,
+		},
+		Block: loop.Block,
+	}
+	return ast.NewNodeReplacement(&nast.StatementLine{
+		Position: loop.Position,
+		Line: ast.Line{
+			Statements: []ast.Statement{start},
+		},
+	}, while)
+}
+
+// unrollForLoop replaces the loop by one copy of its block per iteration. Inside the copies, the loop-variable is replaced by its value.
+func (c *Converter) unrollForLoop(loop *nast.ForLoop, from *vm.Variable, to *vm.Variable) error {
+	if !from.IsNumber() || !to.IsNumber() {
+		return &parser.Error{
+			Message:       "The bounds of a for-loop must be numbers",
+			StartPosition: loop.Start(),
+			EndPosition:   loop.End(),
+		}
+	}
+
+	c.loopcounter++
+	loopnr := c.loopcounter
+	endLabel := fmt.Sprintf("endfor%d", loopnr)
+	one := vm.VariableFromString("1")
+
+	repl := make([]ast.Node, 0)
+	for i := 0; from.Number().LessThanOrEqual(to.Number()); i++ {
+		if i >= maxUnrolledIterations {
+			return &parser.Error{
+				Message:       fmt.Sprintf("A for-loop with constant bounds can not have more than %d iterations", maxUnrolledIterations),
+				StartPosition: loop.Start(),
+				EndPosition:   loop.End(),
+			}
+		}
+		nextLabel := fmt.Sprintf("for%d-next%d", loopnr, i)
+		block := nast.CopyAst(loop.Block).(*nast.Block)
+		err := c.substituteLoopVariable(block, loop, &ast.NumberConstant{Position: loop.Position, Value: from.Itoa()}, endLabel, nextLabel)
+		if err != nil {
+			return err
+		}
+		for _, element := range block.Elements {
+			repl = append(repl, element)
+		}
+		repl = append(repl, &nast.StatementLine{
+			Position: loop.Block.End(),
+			Label:    nextLabel,
+			Line: ast.Line{
+				Statements: []ast.Statement{},
+			},
+		})
+		from, _ = vm.RunBinaryOperation(from, one, "+")
+	}
+	repl = append(repl, &nast.StatementLine{
+		Position: loop.End(),
+		Label:    endLabel,
+		Line: ast.Line{
+			Statements: []ast.Statement{},
+		},
+	})
+
+	return ast.NewNodeReplacement(repl...)
+}
+
+// substituteLoopVariable replaces the loop-variable inside the block of an unrolled loop by the given value.
+// break and continue (if they belong to the unrolled loop) are replaced by gotos to the given labels.
+func (c *Converter) substituteLoopVariable(block *nast.Block, loop *nast.ForLoop, value ast.Expression, endLabel string, nextLabel string) error {
+	variable := loop.Variable
+	// inside nested loops, break and continue belong to the nested loop (unless they use the label of the unrolled loop)
+	nestedLoops := 0
+	// a nested loop can re-use the label of the unrolled loop
+	relabeled := 0
+	enterLoop := func(label string, visitType int) {
+		if visitType == ast.PreVisit {
+			nestedLoops++
+			if label != "" && label == loop.Label {
+				relabeled++
+			}
+		} else if visitType == ast.PostVisit {
+			nestedLoops--
+			if label != "" && label == loop.Label {
+				relabeled--
+			}
+		}
+	}
+	belongsToLoop := func(label string) bool {
+		if label == "" {
+			return nestedLoops == 0
+		}
+		return label == loop.Label && relabeled == 0
+	}
+	// a nested for-loop can re-use the name of the loop variable
+	shadowed := 0
+	return block.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *nast.WhileLoop:
+			enterLoop(n.Label, visitType)
+		case *nast.DoWhileLoop:
+			enterLoop(n.Label, visitType)
+		case *nast.ForLoop:
+			enterLoop(n.Label, visitType)
+			// the bounds of the nested loop still belong to the outer loop
+			if strings.EqualFold(n.Variable, variable) {
+				if visitType == ast.InterVisit2 {
+					shadowed++
+				} else if visitType == ast.PostVisit {
+					shadowed--
+				}
+			}
+		case *nast.StatementLine:
+			if visitType == ast.PreVisit && n.Label != "" {
+				return &parser.Error{
+					Message:       "Labels are not allowed inside of for-loops with constant bounds, as the loop is unrolled",
+					StartPosition: n.Start(),
+					EndPosition:   n.End(),
+				}
+			}
+		case *nast.BreakStatement:
+			if belongsToLoop(n.Label) {
+				return ast.NewNodeReplacementSkip(&nast.GoToLabelStatement{
+					Position: n.Position,
+					Label:    endLabel,
+				})
+			}
+		case *nast.ContinueStatement:
+			if belongsToLoop(n.Label) {
+				return ast.NewNodeReplacementSkip(&nast.GoToLabelStatement{
+					Position: n.Position,
+					Label:    nextLabel,
+				})
+			}
+		case *ast.Assignment:
+			if shadowed == 0 && visitType == ast.PreVisit && strings.EqualFold(n.Variable, variable) {
+				return &parser.Error{
+					Message:       "The variable of a for-loop with constant bounds can not be assigned to",
+					StartPosition: n.Start(),
+					EndPosition:   n.End(),
+				}
+			}
+		case *ast.Dereference:
+			if shadowed == 0 && strings.EqualFold(n.Variable, variable) {
+				if n.Operator != "" {
+					return &parser.Error{
+						Message:       "The variable of a for-loop with constant bounds can not be modified",
+						StartPosition: n.Start(),
+						EndPosition:   n.End(),
+					}
+				}
+				return ast.NewNodeReplacementSkip(nast.CopyAst(value))
+			}
+		}
+		return nil
+	}))
+}
+
+// constantValue returns the value of a number- or string-constant
+func constantValue(exp ast.Expression) *vm.Variable {
+	if str, isstr := exp.(*ast.StringConstant); isstr {
+		return &vm.Variable{Value: str.Value}
+	}
+	return vm.VariableFromString(exp.(*ast.NumberConstant).Value)
+}
+
+// staticValue resolves the definitions used in the given expression and tries to evaluate it at compile-time.
+// The given expression is not modified.
+func (c *Converter) staticValue(exp ast.Expression) ast.Expression {
+	exp = nast.CopyAst(exp).(ast.Expression)
+	resolved, err := ast.AcceptChild(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && deref.Operator == "" {
+			if replacement, exists := c.getDefinition(deref.Variable); exists {
+				return ast.NewNodeReplacementSkip(nast.CopyAst(replacement))
+			}
+		}
+		return nil
+	}), exp)
+	if err != nil {
+		return exp
+	}
+	return c.sexpOptimizer.OptimizeExpression(resolved.(ast.Expression))
+}
@@ -2,6 +2,7 @@ package nolol
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
@@ -29,11 +30,25 @@ func (c *Converter) convertMacroDef(def *nast.MacroDefinition) error {
 	return ast.NewNodeReplacementSkip()
 }
 
+// maxMacroDepth is the maximum number of nested macro-insertions. Deeper nesting is most likely caused by a macro-loop
+const maxMacroDepth = 20
+
+// macroScope returns the scope for the insertion of a macro by the given call.
+// The scope is used as part of variable-names. Dots of qualified macro-names and colons are not allowed there
+func macroScope(call *nast.FuncCall) string {
+	return strings.Replace(call.Function, ".", "_", -1) + "_" + strconv.Itoa(call.Start().Line) + "_" + strconv.Itoa(call.Start().Coloumn)
+}
+
+// insertionScope returns the scope for the insertion of a block-macro by the given call.
+// Calls inside of expression-macros are additionally scoped to the insertion of the expression-macro
+func (c *Converter) insertionScope(call *nast.FuncCall) string {
+	scopes := append(append([]string{}, c.callScopes[call]...), macroScope(call))
+	return strings.Join(scopes, "_")
+}
+
 // convert a macro insetion, by inserting the code defined by the macro
 func (c *Converter) convertMacroInsertion(ins *nast.MacroInsetion) error {
-	c.macroInsertionCount++
-
-	if c.macroInsertionCount > 20 {
+	if len(c.macroLevel) > maxMacroDepth {
 		return &parser.Error{
 			Message:       "Error when processing macros: Macro-loop detected",
 			StartPosition: ast.NewPosition("", 1, 1),
@@ -50,6 +65,14 @@ func (c *Converter) convertMacroInsertion(ins *nast.MacroInsetion) error {
 		}
 	}
 
+	if m.Expression != nil {
+		return &parser.Error{
+			Message:       fmt.Sprintf("The macro '%s' is an expression and can only be used inside of expressions", ins.Function),
+			StartPosition: ins.Start(),
+			EndPosition:   ins.End(),
+		}
+	}
+
 	if len(m.Arguments) != len(ins.Arguments) {
 		return &parser.Error{
 			Message:       fmt.Sprintf("Wrong number of arguments for %s, got %d but want %d", ins.Function, len(ins.Arguments), len(m.Arguments)),
@@ -58,15 +81,142 @@ func (c *Converter) convertMacroInsertion(ins *nast.MacroInsetion) error {
 		}
 	}
 
+	c.usedMacros[strings.ToLower(ins.Function)] = true
+
+	copy := nast.CopyAst(m).(*nast.MacroDefinition)
+
+	err := c.replaceMacroArguments(m, copy, ins.Arguments, strings.Join(c.macroLevel, "_"))
+	if err != nil {
+		return err
+	}
+
+	// remember through which insertions the nodes of the macro have been inserted (for the source-map)
+	expansions := make([]MacroExpansion, len(c.expansions))
+	for i := range c.expansions {
+		expansions[i] = c.expansions[i]
+	}
+	copy.Block.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		c.nodeExpansions[node] = expansions
+		return nil
+	}))
+
+	nodes := make([]ast.Node, len(copy.Block.Elements)+1)
+	for i, el := range copy.Block.Elements {
+		nodes[i] = el
+	}
+	nodes[len(nodes)-1] = &nast.Trigger{
+		Kind: "macroleft",
+	}
+
+	// remove the node from the output-code
+	return ast.NewNodeReplacement(nodes...)
+}
+
+// expandExpressionMacro returns the expression of the given expression-macro, with the arguments of the call inserted
+func (c *Converter) expandExpressionMacro(call *nast.FuncCall, m *nast.MacroDefinition) (ast.Expression, error) {
+	outer := c.callScopes[call]
+	if len(c.macroLevel)+len(outer) > maxMacroDepth {
+		return nil, &parser.Error{
+			Message:       "Error when processing macros: Macro-loop detected",
+			StartPosition: call.Start(),
+			EndPosition:   call.End(),
+		}
+	}
+
+	if len(m.Arguments) != len(call.Arguments) {
+		return nil, &parser.Error{
+			Message:       fmt.Sprintf("Wrong number of arguments for %s, got %d but want %d", call.Function, len(call.Arguments), len(m.Arguments)),
+			StartPosition: call.Start(),
+			EndPosition:   call.End(),
+		}
+	}
+
+	c.usedMacros[strings.ToLower(call.Function)] = true
+
 	copy := nast.CopyAst(m).(*nast.MacroDefinition)
 
+	// calls inside of the macro are scoped to this insertion.
+	// This must happen before the arguments are inserted, as calls inside the arguments belong to the outer scope
+	scopes := append(append([]string{}, outer...), macroScope(call))
+	copy.Expression.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if inner, is := node.(*nast.FuncCall); is && visitType == ast.PreVisit {
+			c.callScopes[inner] = scopes
+		}
+		return nil
+	}))
+
+	levels := append(append([]string{}, c.macroLevel...), scopes...)
+	err := c.replaceMacroArguments(m, copy, call.Arguments, strings.Join(levels, "_"))
+	if err != nil {
+		return nil, err
+	}
+	return copy.Expression, nil
+}
+
+// hoistMacroCalls expands all macro-calls inside the statements of the given line.
+// Expression-macros are replaced by their expression. The code of block-macros is inserted before the line
+// and the call is replaced by the result-variable of the macro.
+// If the line contains calls to block-macros, the replacement for the line is returned as error
+func (c *Converter) hoistMacroCalls(line *nast.StatementLine) error {
+	insertions := make([]ast.Node, 0)
+	err := line.Line.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		call, is := node.(*nast.FuncCall)
+		if !is || visitType != ast.PreVisit || isBuiltinFunction(call.Function) {
+			return nil
+		}
+		m, defined := c.getMacro(call.Function)
+		if !defined {
+			return nil
+		}
+		if m.Expression != nil {
+			expanded, err := c.expandExpressionMacro(call, m)
+			if err != nil {
+				return err
+			}
+			return ast.NewNodeReplacement(expanded)
+		}
+		if m.Result == "" {
+			return &parser.Error{
+				Message:       fmt.Sprintf("The macro '%s' does not return a value. Add 'returns <variable>' to its definition", call.Function),
+				StartPosition: call.Start(),
+				EndPosition:   call.End(),
+			}
+		}
+		for _, arg := range m.Arguments {
+			if strings.ToLower(arg) == strings.ToLower(m.Result) {
+				return &parser.Error{
+					Message:       fmt.Sprintf("The result of the macro '%s' must be a local variable and not an argument", call.Function),
+					StartPosition: call.Start(),
+					EndPosition:   call.End(),
+				}
+			}
+		}
+		insertions = append(insertions, &nast.MacroInsetion{
+			Position: call.Start(),
+			FuncCall: call,
+		})
+		levels := append(append([]string{}, c.macroLevel...), c.insertionScope(call))
+		return ast.NewNodeReplacementSkip(&ast.Dereference{
+			Position: call.Start(),
+			Variable: strings.Join(levels, "_") + "_" + m.Result,
+		})
+	}))
+	if err != nil || len(insertions) == 0 {
+		return err
+	}
+
+	return ast.NewNodeReplacement(moveLineStart(line, append(insertions, line))...)
+}
+
+// replaceMacroArguments replaces the arguments of the macro inside the given copy of the macro with the given values.
+// All local variables inside the macro are prefixed with scope
+func (c *Converter) replaceMacroArguments(m *nast.MacroDefinition, copy *nast.MacroDefinition, arguments []ast.Expression, scope string) error {
 	// gather replacements
 	replacements := make(map[string]ast.Expression)
-	for i := range ins.Arguments {
+	for i := range arguments {
 		lvarname := strings.ToLower(m.Arguments[i])
-		replacements[lvarname] = ins.Arguments[i]
+		replacements[lvarname] = arguments[i]
 	}
-
 	performReplacements := func(node ast.Node, visitType int) error {
 		// replace the variable name inside assignments
 		if ass, is := node.(*ast.Assignment); is && visitType == ast.PreVisit {
@@ -83,8 +233,9 @@ func (c *Converter) convertMacroInsertion(ins *nast.MacroInsetion) error {
 				}
 			} else if !strings.HasPrefix(ass.Variable, ":") {
 				if _, isDefinition := c.getDefinition(lvarname); !isDefinition {
+					c.warnShadowedVariable(m, ass, ass.Variable)
 					// replace local vars with a insertion-scoped version
-					ass.Variable = strings.Join(c.macroLevel, "_") + "_" + ass.Variable
+					ass.Variable = scope + "_" + ass.Variable
 				}
 			}
 		}
@@ -92,6 +243,8 @@ func (c *Converter) convertMacroInsertion(ins *nast.MacroInsetion) error {
 		if deref, is := node.(*ast.Dereference); is && visitType == ast.SingleVisit {
 			lvarname := strings.ToLower(deref.Variable)
 			if replacement, exists := replacements[lvarname]; exists {
+				// the argument can be used multiple times inside the macro. Every usage needs its own copy
+				replacement = nast.CopyAst(replacement).(ast.Expression)
 				if replacementVariable, isvar := replacement.(*ast.Dereference); isvar {
 					if deref.Operator != "" && replacementVariable.Operator != "" {
 						return &parser.Error{
@@ -115,27 +268,45 @@ func (c *Converter) convertMacroInsertion(ins *nast.MacroInsetion) error {
 			} else if !strings.HasPrefix(deref.Variable, ":") {
 
 				if _, isDefinition := c.getDefinition(lvarname); !isDefinition {
+					c.warnShadowedVariable(m, deref, deref.Variable)
 					// replace local vars with a insertion-scoped version
-					deref.Variable = strings.Join(c.macroLevel, "_") + "_" + deref.Variable
+					deref.Variable = scope + "_" + deref.Variable
 				}
 			}
 		}
 		return nil
 	}
 
-	err := copy.Accept(ast.VisitorFunc(performReplacements))
-	if err != nil {
-		return err
-	}
-
-	nodes := make([]ast.Node, len(copy.Block.Elements)+1)
-	for i, el := range copy.Block.Elements {
-		nodes[i] = el
-	}
-	nodes[len(nodes)-1] = &nast.Trigger{
-		Kind: "macroleft",
+	// arrays can be passed to macros by using the name of the array as argument
+	replaceArrayName := func(name string) (string, error) {
+		if replacement, exists := replacements[strings.ToLower(name)]; exists {
+			if replacementVariable, isvar := replacement.(*ast.Dereference); isvar && replacementVariable.Operator == "" {
+				return replacementVariable.Variable, nil
+			}
+			return "", &parser.Error{
+				Message:       "This argument must be the name of an array (and not any other expression)",
+				StartPosition: replacement.Start(),
+				EndPosition:   replacement.End(),
+			}
+		}
+		return name, nil
 	}
 
-	// remove the node from the output-code
-	return ast.NewNodeReplacement(nodes...)
+	return copy.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		var err error
+		switch n := node.(type) {
+		case *nast.ArrayAccess:
+			if visitType == ast.PreVisit {
+				n.Array, err = replaceArrayName(n.Array)
+			}
+		case *nast.ArrayAssignment:
+			if visitType == ast.PreVisit {
+				n.Array, err = replaceArrayName(n.Array)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return performReplacements(node, visitType)
+	}))
 }
@@ -0,0 +1,69 @@
+package nolol
+
+import (
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// convertRawYolol converts the lines of a yolol-block to statement-lines, that are neither merged with other lines nor optimized.
+// Only the names of variables are changed (like everywhere else in the program) and gotos to line-labels are resolved
+func (c *Converter) convertRawYolol(block *nast.RawYololBlock) error {
+	labels := make(map[string]bool)
+	for label := range c.programLabels {
+		labels[label] = true
+	}
+	for _, label := range block.Labels {
+		labels[label] = true
+	}
+
+	repl := make([]ast.Node, len(block.Lines))
+	for i, line := range block.Lines {
+		err := line.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			switch n := node.(type) {
+			case *ast.Assignment:
+				if visitType == ast.PreVisit {
+					n.Variable = c.variableName(n.Variable)
+				}
+			case *ast.Dereference:
+				n.Variable = c.variableName(n.Variable)
+			case *ast.GoToStatement:
+				// "goto name" jumps to a line-label, if there is a label with this name. Otherwise name is a variable
+				if deref, isderef := n.Line.(*ast.Dereference); isderef && visitType == ast.PreVisit && deref.Operator == "" && labels[strings.ToLower(deref.Variable)] {
+					return ast.NewNodeReplacementSkip(&nast.GoToLabelStatement{
+						Position: n.Position,
+						Label:    strings.ToLower(deref.Variable),
+					})
+				}
+			}
+			return nil
+		}))
+		if err != nil {
+			return err
+		}
+
+		stmtline := &nast.StatementLine{
+			Position: line.Position,
+			Line: ast.Line{
+				Position:   line.Position,
+				Statements: line.Statements,
+			},
+			Label:  block.Labels[i],
+			HasBOL: true,
+			// lines without statements (for example comments) are removed, just like everywhere else
+			HasEOL: len(line.Statements) > 0,
+			Raw:    true,
+		}
+		if getLengthOfLine(&stmtline.Line) > c.maxLineLength() {
+			return &parser.Error{
+				Message:       "This line of the yolol-block is too long (>70 characters)",
+				StartPosition: line.Start(),
+				EndPosition:   line.End(),
+			}
+		}
+		repl[i] = stmtline
+	}
+	return ast.NewNodeReplacementSkip(repl...)
+}
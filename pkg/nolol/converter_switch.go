@@ -0,0 +1,287 @@
+package nolol
+
+import (
+	"fmt"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// convertSwitch converts a switch-statement to yolol.
+// A switch can be converted to a chain of ifs or (if all case-values are integers close to each other) to a jump-table using a dynamic goto.
+// Both variants are generated and the one resulting in less lines (or less characters) is used.
+func (c *Converter) convertSwitch(sw *nast.SwitchStatement) error {
+	c.switchcounter++
+	ifchain, err := c.switchToIfChain(nast.CopyAst(sw).(*nast.SwitchStatement))
+	if err != nil {
+		return err
+	}
+	table := c.switchToJumpTable(sw)
+	if table == nil {
+		return ast.NewNodeReplacementSkip(ifchain...)
+	}
+
+	ifchainLines, ifchainChars := c.measureElements(ifchain)
+	tableLines, tableChars := c.measureElements(table)
+	if tableLines < ifchainLines || (tableLines == ifchainLines && tableChars < ifchainChars) {
+		return ast.NewNodeReplacementSkip(table...)
+	}
+	return ast.NewNodeReplacementSkip(ifchain...)
+}
+
+// switchToIfChain converts a switch to a multiline-if with one condition per case
+func (c *Converter) switchToIfChain(sw *nast.SwitchStatement) ([]ast.Node, error) {
+	repl, value := c.storeSwitchValue(sw)
+
+	if len(sw.Cases) == 0 {
+		if sw.Default != nil {
+			for _, element := range sw.Default.Elements {
+				repl = append(repl, element)
+			}
+		}
+		return repl, nil
+	}
+
+	mlif := &nast.MultilineIf{
+		Positions:  make([]ast.Position, len(sw.Cases)),
+		Conditions: make([]ast.Expression, len(sw.Cases)),
+		Blocks:     make([]*nast.Block, len(sw.Cases)),
+		ElseBlock:  sw.Default,
+	}
+	for i, switchcase := range sw.Cases {
+		var condition ast.Expression
+		for _, caseValue := range switchcase.Values {
+			var comparison ast.Expression = &ast.BinaryOperation{
+				Operator: "==",
+				Exp1:     nast.CopyAst(value).(ast.Expression),
+				Exp2:     caseValue,
+			}
+			if condition != nil {
+				comparison = &ast.BinaryOperation{
+					Operator: "or",
+					Exp1:     condition,
+					Exp2:     comparison,
+				}
+			}
+			condition = comparison
+		}
+		mlif.Positions[i] = switchcase.Position
+		mlif.Conditions[i] = c.sexpOptimizer.OptimizeExpression(condition)
+		mlif.Blocks[i] = switchcase.Block
+	}
+
+	err := c.convertIf(mlif)
+	converted, isrepl := err.(ast.NodeReplacement)
+	if !isrepl {
+		return nil, err
+	}
+	return append(repl, converted.Replacement...), nil
+}
+
+// switchToJumpTable converts a switch into a dynamic goto, that jumps directly to the matching case
+// Returns nil, if the case-values are not integers that are close enough to each other
+func (c *Converter) switchToJumpTable(sw *nast.SwitchStatement) []ast.Node {
+	caseIndices := make(map[int64]int)
+	var min, max int64
+	for i, switchcase := range sw.Cases {
+		for _, caseValue := range switchcase.Values {
+			constant, isconst := caseValue.(*ast.NumberConstant)
+			if !isconst {
+				return nil
+			}
+			number := vm.VariableFromString(constant.Value).Number()
+			if !number.Truncate(0).Equal(number) {
+				return nil
+			}
+			intval := number.IntPart()
+			if _, exists := caseIndices[intval]; exists {
+				// like in the if-chain, the first matching case wins
+				continue
+			}
+			if len(caseIndices) == 0 || intval < min {
+				min = intval
+			}
+			if len(caseIndices) == 0 || intval > max {
+				max = intval
+			}
+			caseIndices[intval] = i
+		}
+	}
+	// every value between min and max needs an entry in the table. Gaps are filled with the default-case
+	if len(caseIndices) < 2 || max-min+1 > int64(2*len(caseIndices)) {
+		return nil
+	}
+
+	endLabel := fmt.Sprintf("switch%d-end", c.switchcounter)
+	defaultLabel := endLabel
+	if sw.Default != nil {
+		defaultLabel = fmt.Sprintf("switch%d-default", c.switchcounter)
+	}
+	caseLabel := func(i int) string {
+		return fmt.Sprintf("switch%d-case%d", c.switchcounter, i)
+	}
+
+	// the index 0 (and every index that is out of range) leads to the default case
+	labels := []string{defaultLabel}
+	for value := min; value <= max; value++ {
+		if caseIndex, exists := caseIndices[value]; exists {
+			labels = append(labels, caseLabel(caseIndex))
+		} else {
+			labels = append(labels, defaultLabel)
+		}
+	}
+
+	// the index is evaluated once for every label of the dynamic goto. Complex values are therefore stored in a variable
+	repl, value := c.storeSwitchValue(sw)
+
+	var index ast.Expression = value
+	if min != 1 {
+		operator := "-"
+		offset := min - 1
+		if offset < 0 {
+			operator = "+"
+			offset = -offset
+		}
+		index = &ast.BinaryOperation{
+			Operator: operator,
+			Exp1:     value,
+			Exp2: &ast.NumberConstant{
+				Position: value.Start(),
+				Value:    fmt.Sprint(offset),
+			},
+		}
+	}
+	index = c.sexpOptimizer.OptimizeExpression(index)
+
+	var jump ast.Statement = &nast.DynamicGoToStatement{
+		Position: sw.Position,
+		Labels:   labels,
+		Index:    index,
+	}
+	// if the value is known at compile-time, jump directly to the matching case
+	if constant, isconst := index.(*ast.NumberConstant); isconst {
+		target := defaultLabel
+		number := vm.VariableFromString(constant.Value).Number()
+		if number.Truncate(0).Equal(number) && number.IntPart() >= 0 && number.IntPart() < int64(len(labels)) {
+			target = labels[number.IntPart()]
+		}
+		jump = &nast.GoToLabelStatement{
+			Position: sw.Position,
+			Label:    target,
+		}
+	}
+
+	repl = append(repl, &nast.StatementLine{
+		Position: sw.Position,
+		Line: ast.Line{
+			Statements: []ast.Statement{jump},
+		},
+	})
+	for i, switchcase := range sw.Cases {
+		repl = append(repl, &nast.StatementLine{
+			Position: switchcase.Position,
+			Label:    caseLabel(i),
+			Line: ast.Line{
+				Statements: []ast.Statement{},
+			},
+		})
+		for _, element := range switchcase.Block.Elements {
+			repl = append(repl, element)
+		}
+		// the last block falls through to the end of the switch
+		if i < len(sw.Cases)-1 || sw.Default != nil {
+			repl = append(repl, &nast.StatementLine{
+				Position: switchcase.End(),
+				Line: ast.Line{
+					Statements: []ast.Statement{
+						&nast.GoToLabelStatement{
+							Position: switchcase.End(),
+							Label:    endLabel,
+						},
+					},
+				},
+			})
+		}
+	}
+	if sw.Default != nil {
+		repl = append(repl, &nast.StatementLine{
+			Position: sw.Default.Start(),
+			Label:    defaultLabel,
+			Line: ast.Line{
+				Statements: []ast.Statement{},
+			},
+		})
+		for _, element := range sw.Default.Elements {
+			repl = append(repl, element)
+		}
+	}
+	repl = append(repl, &nast.StatementLine{
+		Position: sw.End(),
+		Label:    endLabel,
+		Line: ast.Line{
+			Statements: []ast.Statement{},
+		},
+	})
+	return repl
+}
+
+// storeSwitchValue returns an expression that can be evaluated multiple times to get the value of the switch.
+// If the value is not a constant or a plain variable, it is assigned to a temporary variable first
+// (so side-effects happen only once). The returned nodes contain this assignment.
+func (c *Converter) storeSwitchValue(sw *nast.SwitchStatement) ([]ast.Node, ast.Expression) {
+	value := sw.Value
+	if deref, isderef := value.(*ast.Dereference); isConstant(value) || (isderef && deref.Operator == "") {
+		return []ast.Node{}, value
+	}
+	tmpvar := c.variableName(fmt.Sprintf("_switch%d", c.switchcounter))
+	assignment := &nast.StatementLine{
+		Position: sw.Position,
+		Line: ast.Line{
+			Statements: []ast.Statement{
+				&ast.Assignment{
+					Position: sw.Position,
+					Variable: tmpvar,
+					Operator: "=",
+					Value:    value,
+				},
+			},
+		},
+	}
+	return []ast.Node{assignment}, &ast.Dereference{
+		Position: value.Start(),
+		Variable: tmpvar,
+	}
+}
+
+// measureElements returns the number of yolol-lines and characters the given (already converted) elements would result in
+func (c *Converter) measureElements(nodes []ast.Node) (int, int) {
+	elements := make([]nast.NestableElement, len(nodes))
+	for i, node := range nodes {
+		elements[i] = node
+	}
+	merged, err := c.mergeNololNestableElements(elements)
+	if err != nil {
+		return 1 << 30, 1 << 30
+	}
+	lines := 0
+	chars := 0
+	for _, element := range merged {
+		line := element.(*nast.StatementLine)
+		if len(line.Statements) == 0 && !line.HasEOL {
+			continue
+		}
+		lines++
+		chars += getLengthOfLine(&line.Line)
+	}
+	return lines, chars
+}
+
+// isConstant returns true if the given expression is a constant value
+func isConstant(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.NumberConstant, *ast.StringConstant:
+		return true
+	}
+	return false
+}
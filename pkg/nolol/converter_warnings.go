@@ -0,0 +1,134 @@
+package nolol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// GetWarnings returns the non-fatal problems that have been found during the conversion.
+// Warnings do not prevent the conversion, but usually point to code that does not do what the author intended
+func (c *Converter) GetWarnings() parser.Errors {
+	return c.warnings
+}
+
+// warn adds a warning. Code can be converted multiple times (for example when unrolling loops). Duplicates are therefore ignored
+func (c *Converter) warn(message string, start ast.Position, end ast.Position) {
+	for _, existing := range c.warnings {
+		if existing.Message == message && existing.StartPosition == start {
+			return
+		}
+	}
+	c.warnings = append(c.warnings, &parser.Error{
+		Message:       message,
+		StartPosition: start,
+		EndPosition:   end,
+	})
+}
+
+// findProgramScope records the labels and local variables that are used in the main-file outside of macros
+func (c *Converter) findProgramScope(prog *nast.Program) {
+	macroDepth := 0
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *nast.MacroDefinition:
+			if visitType == ast.PreVisit {
+				macroDepth++
+			} else if visitType == ast.PostVisit {
+				macroDepth--
+			}
+		case *nast.StatementLine:
+			if visitType == ast.PreVisit && macroDepth == 0 && n.Label != "" {
+				c.programLabels[n.Label] = true
+			}
+		case *nast.RawYololBlock:
+			if visitType == ast.PreVisit && macroDepth == 0 {
+				for _, label := range n.Labels {
+					if label != "" {
+						c.programLabels[label] = true
+					}
+				}
+			}
+		case *ast.Assignment:
+			if visitType == ast.PreVisit && macroDepth == 0 && !strings.HasPrefix(n.Variable, ":") {
+				c.programVariables[strings.ToLower(n.Variable)] = true
+			}
+		case *ast.Dereference:
+			if macroDepth == 0 && !strings.HasPrefix(n.Variable, ":") {
+				c.programVariables[strings.ToLower(n.Variable)] = true
+			}
+		}
+		return nil
+	}))
+}
+
+// warnUnused warns about macros and labels of the main-file that are never used
+func (c *Converter) warnUnused(prog *nast.Program) {
+	names := make([]string, 0, len(c.macros))
+	for name := range c.macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		macro := c.macros[name]
+		// included files are often libraries. It is fine to not use all of their macros
+		if !c.usedMacros[name] && macro.Start().File == "" {
+			c.warn(fmt.Sprintf("The macro '%s' is never used", macro.Name), macro.Start(), macro.Start())
+		}
+	}
+
+	used := make(map[string]bool)
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *nast.GoToLabelStatement:
+			used[n.Label] = true
+		case *nast.DynamicGoToStatement:
+			for _, label := range n.Labels {
+				used[label] = true
+			}
+		}
+		return nil
+	}))
+	for _, element := range prog.Elements {
+		line, isline := element.(*nast.StatementLine)
+		// pinned lines are usually jumped to by their line-number
+		if isline && line.Label != "" && line.PinnedLine == 0 && c.programLabels[line.Label] && !used[line.Label] && line.Start().File == "" {
+			c.warn(fmt.Sprintf("The label '%s' is never used", line.Label), line.Start(), line.Start())
+		}
+	}
+}
+
+// warnConstantWait warns if the condition of a wait can not change while waiting.
+// Only global variables, time() and the condition itself can change the result of the condition
+func (c *Converter) warnConstantWait(wait *nast.WaitDirective) {
+	timeVariable := c.variableName(reservedTimeVariable)
+	changes := false
+	wait.Condition.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, isderef := node.(*ast.Dereference); isderef {
+			if strings.HasPrefix(deref.Variable, ":") || deref.Operator != "" || deref.Variable == timeVariable {
+				changes = true
+			}
+		}
+		return nil
+	}))
+	if !changes {
+		c.warn("The condition of this wait can never change. It either does not wait at all or waits forever", wait.Condition.Start(), wait.Condition.End())
+	}
+}
+
+// warnShadowedVariable warns if a local variable inside of a macro has the same name as a variable of the program.
+// Local variables of macros are scoped to the insertion and do not refer to the variable of the program.
+// Macros of included files (libraries) are intended to be used by programs that do not know their internals and are therefore ignored
+func (c *Converter) warnShadowedVariable(macro *nast.MacroDefinition, node ast.Node, name string) {
+	// internal variables (like the ones of block-locals) can not clash with the variables of the program
+	if strings.HasPrefix(name, "_") {
+		return
+	}
+	if c.programVariables[strings.ToLower(name)] && macro.Start().File == "" {
+		c.warn(fmt.Sprintf("The variable '%s' is local to the macro '%s' and does not refer to the variable '%s' of the program. Pass it as an argument or use a global variable instead", name, macro.Name, name), node.Start(), node.End())
+	}
+}
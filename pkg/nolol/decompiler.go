@@ -0,0 +1,737 @@
+package nolol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/optimizers"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// maxYololLines is the number of lines of a yolol-chip. Gotos to lines after this are clamped to the last line
+const maxYololLines = 20
+
+// nololKeywords are the keywords of nolol that are not keywords in yolol. Yolol-variables with these names must be renamed
+var nololKeywords = []string{"define", "while", "do", "wait", "include", "macro", "insert", "break", "continue"}
+
+// Decompiler converts yolol-programs to nolol-programs
+type Decompiler struct {
+	// the lines of the program, without the statements that can never be executed
+	lines []*ast.Line
+	// the loops that have been found in the program
+	loops []*decompiledLoop
+	// statements that have been replaced by a loop or a wait
+	consumed map[ast.Statement]bool
+	// if-statements that are replaced by a wait-directive
+	waits map[*ast.IfStatement]bool
+	// the numbers of the lines that are targets of gotos
+	targets map[int]bool
+	// the targets for which a label has already been generated
+	labeled map[int]bool
+	// maps the lowercased names of variables to their new names
+	renamed map[string]string
+	// the lowercased names of all variables of the program
+	variables map[string]bool
+	// the variable that stores the line-number of gotos to lines that are only known at runtime
+	targetVariable string
+}
+
+// decompiledLoop describes a back-jump of the yolol-program that is converted to a loop
+type decompiledLoop struct {
+	// the first and the last line of the loop
+	start int
+	end   int
+	// the statement at the end of the last line that jumps back to the first line
+	back ast.Statement
+	// the if-statement at the beginning of the first line that leaves the loop. Nil if the loop has no such check
+	exit *ast.IfStatement
+	// the condition of a do-while loop. Nil if the back-jump is unconditional
+	repeat ast.Expression
+}
+
+// NewDecompiler creates a new decompiler
+func NewDecompiler() *Decompiler {
+	return &Decompiler{}
+}
+
+// Decompile converts the given yolol-program to nolol.
+// Inline-ifs become multiline-ifs, gotos to constant lines become gotos to labels and jumps back to earlier lines become loops, where possible.
+// The generated program behaves like the original one, but the timing differs, as the nolol-compiler decides how the code is split into lines
+func (d *Decompiler) Decompile(prog *ast.Program) (*nast.Program, error) {
+	// the statements of the program are reused for the nolol-program
+	prog = nast.CopyAst(prog).(*ast.Program)
+	d.consumed = make(map[ast.Statement]bool)
+	d.waits = make(map[*ast.IfStatement]bool)
+	d.targets = make(map[int]bool)
+	d.labeled = make(map[int]bool)
+	d.loops = []*decompiledLoop{}
+	d.targetVariable = ""
+	d.lines = make([]*ast.Line, 0, len(prog.Lines))
+	for _, line := range prog.Lines {
+		d.lines = append(d.lines, &ast.Line{
+			Position:   line.Position,
+			Comment:    line.Comment,
+			Statements: reachable(line.Statements),
+		})
+	}
+	// empty lines at the end of the program only waste time
+	for len(d.lines) > 0 && len(d.lines[len(d.lines)-1].Statements) == 0 && d.lines[len(d.lines)-1].Comment == "" {
+		d.lines = d.lines[:len(d.lines)-1]
+	}
+
+	d.renameVariables()
+	d.findLoops()
+	err := d.findTargets(d.allStatements())
+	if err != nil {
+		return nil, err
+	}
+
+	out := &nast.Program{
+		Elements: []nast.Element{},
+	}
+	for _, element := range d.decompileLines(1, len(d.lines), nil) {
+		out.Elements = append(out.Elements, element)
+	}
+	// gotos to lines after the end of the program continue at the beginning of the program
+	if d.targets[len(d.lines)+1] {
+		out.Elements = append(out.Elements, d.labelLine(len(d.lines)+1))
+	}
+	return out, nil
+}
+
+// reachable returns the given statements up to the first goto. Statements after a goto are never executed
+func reachable(stmts []ast.Statement) []ast.Statement {
+	for i, stmt := range stmts {
+		if _, isgoto := stmt.(*ast.GoToStatement); isgoto {
+			return stmts[:i+1]
+		}
+	}
+	return stmts
+}
+
+// labelName returns the name of the label that marks the given line
+func labelName(line int) string {
+	return fmt.Sprintf("line%d", line)
+}
+
+// labelLine returns an empty line that carries the label for the given line
+func (d *Decompiler) labelLine(line int) *nast.StatementLine {
+	d.labeled[line] = true
+	pos := ast.UnknownPosition
+	if line <= len(d.lines) {
+		pos = d.lines[line-1].Position
+	}
+	return &nast.StatementLine{
+		Position: pos,
+		Label:    labelName(line),
+		Line: ast.Line{
+			Position:   pos,
+			Statements: []ast.Statement{},
+		},
+	}
+}
+
+// constantTarget returns the line a goto jumps to, if the line is known at compile-time.
+// Like in the vm, the line-number is clamped to the lines of a chip. Empty lines after the end of the program are skipped.
+func (d *Decompiler) constantTarget(gotostmt *ast.GoToStatement) (int, bool, error) {
+	exp := optimizers.NewStaticExpressionOptimizer().OptimizeExpression(nast.CopyAst(gotostmt.Line).(ast.Expression))
+	switch target := exp.(type) {
+	case *ast.StringConstant:
+		return 0, false, &parser.Error{
+			Message:       "Can not goto a string",
+			StartPosition: gotostmt.Start(),
+			EndPosition:   gotostmt.End(),
+		}
+	case *ast.NumberConstant:
+		line := int(vm.VariableFromString(target.Value).Number().IntPart())
+		if line < 1 {
+			line = 1
+		}
+		if line > maxYololLines {
+			line = maxYololLines
+		}
+		if line > len(d.lines) {
+			line = len(d.lines) + 1
+		}
+		return line, true, nil
+	}
+	return 0, false, nil
+}
+
+// conditionalJump checks if the given statement is an if that contains nothing but a goto to a constant line.
+// Returns the line that is jumped to
+func (d *Decompiler) conditionalJump(stmt ast.Statement) (int, bool) {
+	ifstmt, isif := stmt.(*ast.IfStatement)
+	if !isif || len(ifstmt.ElseBlock) > 0 || len(ifstmt.IfBlock) != 1 {
+		return 0, false
+	}
+	gotostmt, isgoto := ifstmt.IfBlock[0].(*ast.GoToStatement)
+	if !isgoto {
+		return 0, false
+	}
+	line, isconst, _ := d.constantTarget(gotostmt)
+	return line, isconst
+}
+
+// findLoops searches for back-jumps at the end of lines.
+// "goto start" becomes a while-loop. If the first line of the loop starts with a check that jumps behind the loop, this check becomes the condition of the loop.
+// "if cond then goto start end" becomes a do-while loop, or a wait-directive if the loop consists of nothing else.
+// Loops that would overlap with longer loops are left as they are
+func (d *Decompiler) findLoops() {
+	candidates := []*decompiledLoop{}
+	for i, line := range d.lines {
+		end := i + 1
+		if len(line.Statements) == 0 {
+			continue
+		}
+		last := line.Statements[len(line.Statements)-1]
+		switch stmt := last.(type) {
+		case *ast.GoToStatement:
+			start, isconst, _ := d.constantTarget(stmt)
+			if !isconst || start > end {
+				continue
+			}
+			loop := &decompiledLoop{
+				start: start,
+				end:   end,
+				back:  stmt,
+			}
+			if first := d.lines[start-1].Statements; len(first) > 0 && first[0] != last {
+				if exit, isexit := d.conditionalJump(first[0]); isexit && exit == end+1 && exit <= maxYololLines {
+					loop.exit = first[0].(*ast.IfStatement)
+				}
+			}
+			candidates = append(candidates, loop)
+		case *ast.IfStatement:
+			start, isjump := d.conditionalJump(stmt)
+			if !isjump || start > end {
+				continue
+			}
+			if start == end && len(line.Statements) == 1 {
+				d.waits[stmt] = true
+				continue
+			}
+			candidates = append(candidates, &decompiledLoop{
+				start:  start,
+				end:    end,
+				back:   stmt,
+				repeat: stmt.Condition,
+			})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].end-candidates[i].start > candidates[j].end-candidates[j].start
+	})
+
+	for _, candidate := range candidates {
+		overlaps := false
+		for _, loop := range d.loops {
+			if (loop.start < candidate.start && candidate.start <= loop.end && loop.end < candidate.end) ||
+				(candidate.start < loop.start && loop.start <= candidate.end && candidate.end < loop.end) {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		for _, loop := range d.loops {
+			// the inner loop jumps back to the exit-check of the outer loop. The check must therefore stay in the inner loop
+			if loop.start == candidate.start {
+				loop.exit = nil
+			}
+		}
+		d.loops = append(d.loops, candidate)
+	}
+
+	for _, loop := range d.loops {
+		d.consumed[loop.back] = true
+		if loop.exit != nil {
+			d.consumed[loop.exit] = true
+		}
+	}
+}
+
+// allStatements returns the statements of all lines
+func (d *Decompiler) allStatements() []ast.Statement {
+	stmts := []ast.Statement{}
+	for _, line := range d.lines {
+		stmts = append(stmts, line.Statements...)
+	}
+	return stmts
+}
+
+// findTargets finds the lines that are jumped to by the remaining gotos.
+// A goto to a line that is only known at runtime can jump to any line
+func (d *Decompiler) findTargets(stmts []ast.Statement) error {
+	for _, stmt := range stmts {
+		if d.consumed[stmt] {
+			continue
+		}
+		switch s := stmt.(type) {
+		case *ast.GoToStatement:
+			line, isconst, err := d.constantTarget(s)
+			if err != nil {
+				return err
+			}
+			if isconst {
+				d.targets[line] = true
+				continue
+			}
+			for _, label := range d.allLabels() {
+				d.targets[label] = true
+			}
+		case *ast.IfStatement:
+			if d.waits[s] {
+				continue
+			}
+			err := d.findTargets(reachable(s.IfBlock))
+			if err != nil {
+				return err
+			}
+			err = d.findTargets(reachable(s.ElseBlock))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// allLabels returns the numbers of all lines a goto can jump to
+func (d *Decompiler) allLabels() []int {
+	lines := len(d.lines)
+	if lines < maxYololLines {
+		lines++
+	}
+	labels := make([]int, lines)
+	for i := range labels {
+		labels[i] = i + 1
+	}
+	return labels
+}
+
+// renameVariables renames variables whose names are keywords in nolol
+func (d *Decompiler) renameVariables() {
+	d.renamed = make(map[string]string)
+	d.variables = make(map[string]bool)
+	names := []string{}
+	visitor := ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		name := ""
+		switch n := node.(type) {
+		case *ast.Assignment:
+			name = n.Variable
+		case *ast.Dereference:
+			name = n.Variable
+		default:
+			return nil
+		}
+		name = strings.ToLower(name)
+		if !d.variables[name] {
+			d.variables[name] = true
+			names = append(names, name)
+		}
+		return nil
+	})
+	for _, line := range d.lines {
+		line.Accept(visitor)
+	}
+
+	for _, name := range names {
+		for _, keyword := range nololKeywords {
+			if name != keyword {
+				continue
+			}
+			d.renamed[name] = d.unusedName(name + "_")
+		}
+	}
+}
+
+// unusedName returns a variable-name that is not used by the program. If the given name is used, underscores are appended to it
+func (d *Decompiler) unusedName(name string) string {
+	for d.variables[name] {
+		name += "_"
+	}
+	d.variables[name] = true
+	return name
+}
+
+// variable returns the name of the given variable in the nolol-program
+func (d *Decompiler) variable(name string) string {
+	if newname, exists := d.renamed[strings.ToLower(name)]; exists {
+		return newname
+	}
+	return name
+}
+
+// expression converts a yolol-expression to nolol. The unary keyword-operators of yolol become function-calls
+func (d *Decompiler) expression(exp ast.Expression) ast.Expression {
+	converted, _ := ast.AcceptChild(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *ast.Dereference:
+			n.Variable = d.variable(n.Variable)
+		case *ast.UnaryOperation:
+			if visitType != ast.PostVisit || !isBuiltinFunction(n.Operator) {
+				return nil
+			}
+			return ast.NewNodeReplacementSkip(&nast.FuncCall{
+				Position:  n.Position,
+				Function:  n.Operator,
+				Arguments: []ast.Expression{n.Exp},
+			})
+		}
+		return nil
+	}), exp)
+	return converted.(ast.Expression)
+}
+
+// decompileLines converts the lines from "from" to "to" (inclusive) to nolol.
+// enclosing is the loop the lines belong to. It is not generated again
+func (d *Decompiler) decompileLines(from int, to int, enclosing *decompiledLoop) []nast.NestableElement {
+	elements := []nast.NestableElement{}
+	for i := from; i <= to; {
+		var loop *decompiledLoop
+		for _, candidate := range d.loops {
+			if candidate.start == i && candidate.end <= to && candidate != enclosing && (loop == nil || candidate.end > loop.end) {
+				loop = candidate
+			}
+		}
+		if loop == nil {
+			elements = append(elements, d.decompileLine(i)...)
+			i++
+			continue
+		}
+		if d.targets[i] && !d.labeled[i] {
+			elements = append(elements, d.labelLine(i))
+		}
+		elements = append(elements, d.decompileLoop(loop))
+		i = loop.end + 1
+	}
+	return elements
+}
+
+// decompileLoop converts the given loop to a while- or do-while-loop
+func (d *Decompiler) decompileLoop(loop *decompiledLoop) nast.NestableElement {
+	pos := d.lines[loop.start-1].Position
+	block := &nast.Block{
+		Elements: d.decompileLines(loop.start, loop.end, loop),
+	}
+	if loop.repeat != nil {
+		return &nast.DoWhileLoop{
+			Position:  pos,
+			Block:     block,
+			Condition: d.expression(loop.repeat),
+		}
+	}
+	var condition ast.Expression = &ast.NumberConstant{
+		Position: pos,
+		Value:    "1",
+	}
+	if loop.exit != nil {
+		condition = (&optimizers.ExpressionInversionOptimizer{}).OptimizeExpression(&ast.UnaryOperation{
+			Position: loop.exit.Condition.Start(),
+			Operator: "not",
+			Exp:      d.expression(loop.exit.Condition),
+		})
+	}
+	return &nast.WhileLoop{
+		Position:  pos,
+		Condition: condition,
+		Block:     block,
+	}
+}
+
+// decompileLine converts a single line to nolol. The line receives a label if it is the target of a goto
+func (d *Decompiler) decompileLine(number int) []nast.NestableElement {
+	line := d.lines[number-1]
+	failing := mayFail(line.Statements)
+	elements := d.decompileStatements(line.Statements)
+	if failing {
+		elements = keepLineTogether(elements)
+	}
+
+	if line.Comment != "" {
+		last, isline := nast.NestableElement(nil), false
+		if len(elements) > 0 {
+			last = elements[len(elements)-1]
+			_, isline = last.(*nast.StatementLine)
+		}
+		if isline && len(last.(*nast.StatementLine).Statements) > 0 {
+			last.(*nast.StatementLine).Comment = line.Comment
+		} else {
+			elements = append([]nast.NestableElement{&nast.StatementLine{
+				Position: line.Position,
+				Line: ast.Line{
+					Position:   line.Position,
+					Statements: []ast.Statement{},
+				},
+				Comment: line.Comment,
+			}}, elements...)
+		}
+	}
+
+	if d.targets[number] && !d.labeled[number] {
+		first, isline := nast.NestableElement(nil), false
+		if len(elements) > 0 {
+			first = elements[0]
+			_, isline = first.(*nast.StatementLine)
+		}
+		if isline {
+			d.labeled[number] = true
+			first.(*nast.StatementLine).Label = labelName(number)
+		} else {
+			elements = append([]nast.NestableElement{d.labelLine(number)}, elements...)
+		}
+	}
+	return elements
+}
+
+// mayFail returns true if executing the given statements could result in a runtime-error.
+// A runtime-error aborts the rest of the line, so the statements of such a line must not be mixed with the statements of other lines
+func mayFail(stmts []ast.Statement) bool {
+	failing := false
+	for _, stmt := range stmts {
+		stmt.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			switch n := node.(type) {
+			case *ast.UnaryOperation:
+				// every unary operation fails for strings
+				failing = true
+			case *ast.BinaryOperation:
+				switch n.Operator {
+				case "+", "-", "==", "!=":
+				default:
+					failing = true
+				}
+			case *ast.Dereference:
+				// decrementing an empty string fails
+				if n.Operator == "--" {
+					failing = true
+				}
+			case *ast.IfStatement:
+				// the condition could be a string
+				if visitType == ast.PreVisit {
+					if _, isderef := n.Condition.(*ast.Dereference); isderef {
+						failing = true
+					}
+				}
+			case *ast.GoToStatement:
+				// the line could be a string
+				if _, isconst := n.Line.(*ast.NumberConstant); !isconst {
+					failing = true
+				}
+			}
+			return nil
+		}))
+	}
+	return failing
+}
+
+// keepLineTogether makes sure the given decompiled statements of a yolol-line end up on a yolol-line of their own.
+// If possible, all statements are placed on a single nolol-line, that starts and ends a yolol-line.
+// Otherwise, at least the first and the last line of the decompiled statements are marked accordingly
+func keepLineTogether(elements []nast.NestableElement) []nast.NestableElement {
+	if len(elements) == 0 {
+		return elements
+	}
+	combined := &nast.StatementLine{
+		Line: ast.Line{
+			Statements: []ast.Statement{},
+		},
+		HasBOL: true,
+		HasEOL: true,
+	}
+	for _, element := range elements {
+		line, isline := element.(*nast.StatementLine)
+		if !isline || len(line.Statements) == 0 {
+			combined = nil
+			break
+		}
+		combined.Statements = append(combined.Statements, line.Statements...)
+	}
+	if combined != nil {
+		combined.Position = elements[0].Start()
+		combined.Line.Position = elements[0].Start()
+		return []nast.NestableElement{combined}
+	}
+
+	if first, isline := elements[0].(*nast.StatementLine); isline {
+		first.HasBOL = true
+	}
+	if last, isline := elements[len(elements)-1].(*nast.StatementLine); isline && len(last.Statements) > 0 {
+		last.HasEOL = true
+	}
+	return elements
+}
+
+// decompileStatements converts yolol-statements to nolol. Every statement is put on its own line and inline-ifs become multiline-ifs
+func (d *Decompiler) decompileStatements(stmts []ast.Statement) []nast.NestableElement {
+	elements := []nast.NestableElement{}
+	for _, stmt := range reachable(stmts) {
+		if d.consumed[stmt] {
+			continue
+		}
+		var converted ast.Statement
+		switch s := stmt.(type) {
+		case *ast.IfStatement:
+			if d.waits[s] {
+				// like in parsed code, the wait is terminated by an empty line
+				elements = append(elements, &nast.WaitDirective{
+					Position:  s.Position,
+					Condition: d.expression(s.Condition),
+				}, &nast.StatementLine{
+					Position: s.Position,
+					Line: ast.Line{
+						Position:   s.Position,
+						Statements: []ast.Statement{},
+					},
+				})
+			} else {
+				elements = append(elements, d.decompileIf(s))
+			}
+			continue
+		case *ast.GoToStatement:
+			elements = append(elements, d.decompileGoto(s)...)
+			continue
+		case *ast.Assignment:
+			s.Variable = d.variable(s.Variable)
+			s.Value = d.expression(s.Value)
+			converted = s
+		case *ast.Dereference:
+			s.Variable = d.variable(s.Variable)
+			converted = s
+		default:
+			converted = s
+		}
+		elements = append(elements, &nast.StatementLine{
+			Position: stmt.Start(),
+			Line: ast.Line{
+				Position:   stmt.Start(),
+				Statements: []ast.Statement{converted},
+			},
+		})
+	}
+	return elements
+}
+
+// decompileIf converts an inline-if to a multiline-if. Ifs that are the only statement of an else-block become else-ifs
+func (d *Decompiler) decompileIf(ifstmt *ast.IfStatement) *nast.MultilineIf {
+	mlif := &nast.MultilineIf{
+		Positions:  []ast.Position{},
+		Conditions: []ast.Expression{},
+		Blocks:     []*nast.Block{},
+	}
+	for {
+		mlif.Positions = append(mlif.Positions, ifstmt.Position)
+		mlif.Conditions = append(mlif.Conditions, d.expression(ifstmt.Condition))
+		mlif.Blocks = append(mlif.Blocks, &nast.Block{
+			Elements: d.decompileStatements(ifstmt.IfBlock),
+		})
+		if len(ifstmt.ElseBlock) == 1 {
+			if elseif, iselseif := ifstmt.ElseBlock[0].(*ast.IfStatement); iselseif {
+				ifstmt = elseif
+				continue
+			}
+		}
+		if len(ifstmt.ElseBlock) > 0 {
+			mlif.ElseBlock = &nast.Block{
+				Elements: d.decompileStatements(ifstmt.ElseBlock),
+			}
+		}
+		return mlif
+	}
+}
+
+// decompileGoto converts a goto to a goto to a label.
+// If the line is only known at runtime, an if-chain is generated that compares the line-number with every line.
+// This way, the line-number is truncated and clamped like in the vm
+func (d *Decompiler) decompileGoto(gotostmt *ast.GoToStatement) []nast.NestableElement {
+	line, isconst, _ := d.constantTarget(gotostmt)
+	if isconst {
+		return []nast.NestableElement{
+			&nast.StatementLine{
+				Position: gotostmt.Position,
+				Line: ast.Line{
+					Position: gotostmt.Position,
+					Statements: []ast.Statement{
+						&nast.GoToLabelStatement{
+							Position: gotostmt.Position,
+							Label:    labelName(line),
+						},
+					},
+				},
+			},
+		}
+	}
+
+	elements := []nast.NestableElement{}
+	target := d.expression(gotostmt.Line)
+	if deref, isderef := target.(*ast.Dereference); !isderef || deref.Operator != "" {
+		// the line-number is compared multiple times and must therefore only be computed once
+		if d.targetVariable == "" {
+			d.targetVariable = d.unusedName("target")
+		}
+		elements = append(elements, &nast.StatementLine{
+			Position: gotostmt.Position,
+			Line: ast.Line{
+				Position: gotostmt.Position,
+				Statements: []ast.Statement{
+					&ast.Assignment{
+						Position: gotostmt.Position,
+						Variable: d.targetVariable,
+						Operator: "=",
+						Value:    target,
+					},
+				},
+			},
+		})
+		target = &ast.Dereference{
+			Position: gotostmt.Position,
+			Variable: d.targetVariable,
+		}
+	}
+
+	jump := func(line int) *nast.Block {
+		return &nast.Block{
+			Elements: []nast.NestableElement{
+				&nast.StatementLine{
+					Position: gotostmt.Position,
+					Line: ast.Line{
+						Position: gotostmt.Position,
+						Statements: []ast.Statement{
+							&nast.GoToLabelStatement{
+								Position: gotostmt.Position,
+								Label:    labelName(line),
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	labels := d.allLabels()
+	chain := &nast.MultilineIf{
+		Positions:  []ast.Position{},
+		Conditions: []ast.Expression{},
+		Blocks:     []*nast.Block{},
+		ElseBlock:  jump(labels[len(labels)-1]),
+	}
+	for _, line := range labels[:len(labels)-1] {
+		chain.Positions = append(chain.Positions, gotostmt.Position)
+		chain.Conditions = append(chain.Conditions, &ast.BinaryOperation{
+			Operator: "<",
+			Exp1:     nast.CopyAst(target).(ast.Expression),
+			Exp2: &ast.NumberConstant{
+				Position: gotostmt.Position,
+				Value:    fmt.Sprint(line + 1),
+			},
+		})
+		chain.Blocks = append(chain.Blocks, jump(line))
+	}
+	return append(elements, chain)
+}
@@ -45,6 +45,10 @@ type StatementLine struct {
 	Label    string
 	Position ast.Position
 	Comment  string
+	// If true, the line has been written in yolol (inside of a yolol-block) and must not be changed by optimizations
+	Raw bool
+	// The yolol-line this line must be placed at (@line N). 0 if the line can be placed anywhere
+	PinnedLine int
 }
 
 // Start is needed to implement ast.Node
@@ -120,6 +124,48 @@ func (n *MultilineIf) End() ast.Position {
 	return n.ElseBlock.End()
 }
 
+// SwitchStatement executes the block of the case whose value equals the value of the switch
+// If no case matches, the default-block is executed (if it exists)
+type SwitchStatement struct {
+	Position ast.Position
+	Value    ast.Expression
+	Cases    []*SwitchCase
+	Default  *Block
+}
+
+// Start is needed to implement ast.Node
+func (n *SwitchStatement) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *SwitchStatement) End() ast.Position {
+	if n.Default != nil {
+		return n.Default.End()
+	}
+	if len(n.Cases) == 0 {
+		return n.Value.End()
+	}
+	return n.Cases[len(n.Cases)-1].End()
+}
+
+// SwitchCase is a single case of a switch-statement
+type SwitchCase struct {
+	Position ast.Position
+	Values   []ast.Expression
+	Block    *Block
+}
+
+// Start is needed to implement ast.Node
+func (n *SwitchCase) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *SwitchCase) End() ast.Position {
+	return n.Block.End()
+}
+
 // GoToLabelStatement represents a goto to a line-label
 type GoToLabelStatement struct {
 	Position ast.Position
@@ -136,9 +182,29 @@ func (n *GoToLabelStatement) End() ast.Position {
 	return n.Position.Add(len(n.Label) + 1)
 }
 
+// DynamicGoToStatement represents a goto that chooses one of multiple line-labels at runtime
+// The label at the position Index (starting with 0) is jumped to. If Index is out of range, the first label is used
+type DynamicGoToStatement struct {
+	Position ast.Position
+	Labels   []string
+	Index    ast.Expression
+}
+
+// Start is needed to implement ast.Node
+func (n *DynamicGoToStatement) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *DynamicGoToStatement) End() ast.Position {
+	return n.Index.End()
+}
+
 // WhileLoop represents a nolol-style while loop
 type WhileLoop struct {
-	Position  ast.Position
+	Position ast.Position
+	// the name of the loop, used to break out of (or continue) this loop from inside nested loops. Empty if the loop has no label
+	Label     string
 	Condition ast.Expression
 	Block     *Block
 }
@@ -156,11 +222,85 @@ func (n *WhileLoop) End() ast.Position {
 	return n.Block.End()
 }
 
+// DoWhileLoop represents a loop that checks its condition after each iteration (do ... while condition)
+type DoWhileLoop struct {
+	Position ast.Position
+	// the name of the loop. Empty if the loop has no label
+	Label     string
+	Block     *Block
+	Condition ast.Expression
+}
+
+// Start is needed to implement ast.Node
+func (n *DoWhileLoop) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *DoWhileLoop) End() ast.Position {
+	if n.Condition == nil {
+		return n.Position
+	}
+	return n.Condition.End()
+}
+
+// ForLoop represents a loop that counts a variable from one value to another (inclusive)
+type ForLoop struct {
+	Position ast.Position
+	// the name of the loop. Empty if the loop has no label
+	Label    string
+	Variable string
+	From     ast.Expression
+	To       ast.Expression
+	Block    *Block
+}
+
+// Start is needed to implement ast.Node
+func (n *ForLoop) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *ForLoop) End() ast.Position {
+	if n.Block == nil {
+		return n.Position
+	}
+	return n.Block.End()
+}
+
+// CompileTimeIf includes one of two blocks, depending on a condition that is evaluated at compile-time
+type CompileTimeIf struct {
+	Position  ast.Position
+	Condition ast.Expression
+	IfBlock   *Block
+	ElseBlock *Block
+}
+
+// Start is needed to implement ast.Node
+func (n *CompileTimeIf) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *CompileTimeIf) End() ast.Position {
+	if n.ElseBlock != nil {
+		return n.ElseBlock.End()
+	}
+	if n.IfBlock == nil {
+		return n.Position
+	}
+	return n.IfBlock.End()
+}
+
 // WaitDirective blocks execution as long as the condition is true
 type WaitDirective struct {
 	Position   ast.Position
 	Condition  ast.Expression
 	Statements []ast.Statement
+	// the maximum number of lines to wait. Nil if the wait has no timeout
+	Timeout ast.Expression
+	// the statements that are executed instead of Statements, if the timeout is reached
+	Else []ast.Statement
 }
 
 // Start is needed to implement ast.Node
@@ -170,7 +310,13 @@ func (n *WaitDirective) Start() ast.Position {
 
 // End is needed to implement ast.Node
 func (n *WaitDirective) End() ast.Position {
+	if len(n.Else) > 0 {
+		return n.Else[len(n.Else)-1].End()
+	}
 	if n.Statements == nil || len(n.Statements) == 0 {
+		if n.Timeout != nil {
+			return n.Timeout.End()
+		}
 		if n.Condition == nil {
 			return n.Position
 		}
@@ -183,6 +329,8 @@ func (n *WaitDirective) End() ast.Position {
 type IncludeDirective struct {
 	Position ast.Position
 	File     string
+	// if set, the definitions and macros of the file can only be accessed using <Namespace>.<name>
+	Namespace string
 }
 
 // Start is needed to implement ast.Node
@@ -192,6 +340,9 @@ func (n *IncludeDirective) Start() ast.Position {
 
 // End is needed to implement ast.Node
 func (n *IncludeDirective) End() ast.Position {
+	if n.Namespace != "" {
+		return n.Position.Add(len(n.File) + 3 + len("include") + len(" as ") + len(n.Namespace))
+	}
 	return n.Position.Add(len(n.File) + 3 + len("include"))
 }
 
@@ -200,7 +351,12 @@ type MacroDefinition struct {
 	Position  ast.Position
 	Name      string
 	Arguments []string
-	Block     *Block
+	// the code of block-macros. Nil for expression-macros
+	Block *Block
+	// the expression of expression-macros. Nil for block-macros
+	Expression ast.Expression
+	// the local variable that contains the result of a block-macro, if it is used inside an expression
+	Result string
 }
 
 // Start is needed to implement ast.Node
@@ -210,6 +366,9 @@ func (n *MacroDefinition) Start() ast.Position {
 
 // End is needed to implement ast.Node
 func (n *MacroDefinition) End() ast.Position {
+	if n.Expression != nil {
+		return n.Expression.End()
+	}
 	if n.Block == nil {
 		return n.Position
 	}
@@ -273,9 +432,26 @@ func (n *FuncCall) End() ast.Position {
 	return n.Position.Add(len(n.Function) + 2)
 }
 
+// ChipBoundary marks the end of the code for one chip and the beginning of the code for the next chip
+type ChipBoundary struct {
+	Position ast.Position
+}
+
+// Start is needed to implement ast.Node
+func (n *ChipBoundary) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *ChipBoundary) End() ast.Position {
+	return n.Position.Add(len("#chip"))
+}
+
 // BreakStatement represents the break-keyword inside a loop
 type BreakStatement struct {
 	Position ast.Position
+	// the label of the loop to break out of. If empty, the innermost loop is used
+	Label string
 }
 
 // Start is needed to implement ast.Node
@@ -285,12 +461,17 @@ func (n *BreakStatement) Start() ast.Position {
 
 // End is needed to implement ast.Node
 func (n *BreakStatement) End() ast.Position {
+	if n.Label != "" {
+		return n.Position.Add(len("break ") + len(n.Label))
+	}
 	return n.Position.Add(len("break"))
 }
 
 // ContinueStatement represents the continue-keyword inside a loop
 type ContinueStatement struct {
 	Position ast.Position
+	// the label of the loop to continue. If empty, the innermost loop is used
+	Label string
 }
 
 // Start is needed to implement ast.Node
@@ -300,5 +481,170 @@ func (n *ContinueStatement) Start() ast.Position {
 
 // End is needed to implement ast.Node
 func (n *ContinueStatement) End() ast.Position {
+	if n.Label != "" {
+		return n.Position.Add(len("continue ") + len(n.Label))
+	}
 	return n.Position.Add(len("continue"))
 }
+
+// ArrayDeclaration declares an array, that is emulated using one variable per element
+type ArrayDeclaration struct {
+	Position ast.Position
+	Name     string
+	// the number of elements, if the array has been declared as name[size]. The first index is then 0
+	Size ast.Expression
+	// the first and last index, if the array has been declared as name[from to to]
+	From ast.Expression
+	To   ast.Expression
+}
+
+// Start is needed to implement ast.Node
+func (n *ArrayDeclaration) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *ArrayDeclaration) End() ast.Position {
+	if n.To != nil {
+		return n.To.End().Add(1)
+	}
+	if n.Size != nil {
+		return n.Size.End().Add(1)
+	}
+	return n.Position
+}
+
+// ArrayAccess reads an element of an array
+type ArrayAccess struct {
+	Position ast.Position
+	Array    string
+	Index    ast.Expression
+}
+
+// Start is needed to implement ast.Node
+func (n *ArrayAccess) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *ArrayAccess) End() ast.Position {
+	return n.Index.End().Add(1)
+}
+
+// ArrayAssignment assigns a value to an element of an array
+type ArrayAssignment struct {
+	Position ast.Position
+	Array    string
+	Index    ast.Expression
+	Operator string
+	Value    ast.Expression
+}
+
+// Start is needed to implement ast.Node
+func (n *ArrayAssignment) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *ArrayAssignment) End() ast.Position {
+	return n.Value.End()
+}
+
+// LocalDeclaration declares a variable that is only visible until the end of the enclosing block
+type LocalDeclaration struct {
+	Position ast.Position
+	Name     string
+	// the initial value of the variable. Can be nil
+	Value ast.Expression
+}
+
+// Start is needed to implement ast.Node
+func (n *LocalDeclaration) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *LocalDeclaration) End() ast.Position {
+	if n.Value != nil {
+		return n.Value.End()
+	}
+	return n.Position.Add(len("local ") + len(n.Name))
+}
+
+// RawYololBlock contains lines of yolol-code, that are copied to the output without being merged, reordered or optimized
+type RawYololBlock struct {
+	Position ast.Position
+	Lines    []*ast.Line
+	// the line-labels of the lines. Empty, if the line has no label
+	Labels      []string
+	EndPosition ast.Position
+}
+
+// Start is needed to implement ast.Node
+func (n *RawYololBlock) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *RawYololBlock) End() ast.Position {
+	return n.EndPosition
+}
+
+// Assertion checks a condition at runtime, if the program is not compiled as release. If the condition is false, the execution is stopped with an error
+type Assertion struct {
+	Position  ast.Position
+	Condition ast.Expression
+	// the message to report if the assertion fails. Can be empty
+	Message string
+}
+
+// Start is needed to implement ast.Node
+func (n *Assertion) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *Assertion) End() ast.Position {
+	if n.Message != "" {
+		return n.Condition.End().Add(len(n.Message) + 4)
+	}
+	return n.Condition.End()
+}
+
+// DebugBlock contains code that is only included, if the program is not compiled as release
+type DebugBlock struct {
+	Position ast.Position
+	Block    *Block
+}
+
+// Start is needed to implement ast.Node
+func (n *DebugBlock) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *DebugBlock) End() ast.Position {
+	if n.Block == nil {
+		return n.Position
+	}
+	return n.Block.End()
+}
+
+// Sleep pauses the execution for the given number of lines
+type Sleep struct {
+	Position ast.Position
+	Duration ast.Expression
+}
+
+// Start is needed to implement ast.Node
+func (n *Sleep) Start() ast.Position {
+	return n.Position
+}
+
+// End is needed to implement ast.Node
+func (n *Sleep) End() ast.Position {
+	if n.Duration == nil {
+		return n.Position
+	}
+	return n.Duration.End().Add(1)
+}
@@ -72,6 +72,12 @@ func CopyAst(inp ast.Node) ast.Node {
 				m := &GoToLabelStatement{}
 				copier.Copy(m, n)
 				newnode = m
+			case *DynamicGoToStatement:
+				m := &DynamicGoToStatement{}
+				copier.Copy(m, n)
+				m.Labels = make([]string, len(n.Labels))
+				copy(m.Labels, n.Labels)
+				newnode = m
 			case *Block:
 				m := &Block{}
 				copier.Copy(m, n)
@@ -85,7 +91,9 @@ func CopyAst(inp ast.Node) ast.Node {
 				copy(m.Arguments, n.Arguments)
 				newnode = m
 			case *MacroInsetion:
-				m := &MacroInsetion{}
+				m := &MacroInsetion{
+					FuncCall: n.FuncCall,
+				}
 				copier.Copy(m, n)
 				newnode = m
 			case *FuncCall:
@@ -104,10 +112,38 @@ func CopyAst(inp ast.Node) ast.Node {
 				m.Blocks = make([]*Block, len(n.Blocks))
 				copy(m.Blocks, n.Blocks)
 				newnode = m
+			case *SwitchStatement:
+				m := &SwitchStatement{}
+				copier.Copy(m, n)
+				m.Cases = make([]*SwitchCase, len(n.Cases))
+				copy(m.Cases, n.Cases)
+				newnode = m
+			case *SwitchCase:
+				m := &SwitchCase{}
+				copier.Copy(m, n)
+				m.Values = make([]ast.Expression, len(n.Values))
+				copy(m.Values, n.Values)
+				newnode = m
 			case *WhileLoop:
 				m := &WhileLoop{}
 				copier.Copy(m, n)
 				newnode = m
+			case *DoWhileLoop:
+				m := &DoWhileLoop{}
+				copier.Copy(m, n)
+				newnode = m
+			case *ForLoop:
+				m := &ForLoop{}
+				copier.Copy(m, n)
+				newnode = m
+			case *ChipBoundary:
+				m := &ChipBoundary{}
+				copier.Copy(m, n)
+				newnode = m
+			case *CompileTimeIf:
+				m := &CompileTimeIf{}
+				copier.Copy(m, n)
+				newnode = m
 			case *StatementLine:
 				m := &StatementLine{
 					Line: n.Line,
@@ -131,15 +167,55 @@ func CopyAst(inp ast.Node) ast.Node {
 			case *WaitDirective:
 				m := &WaitDirective{}
 				copier.Copy(m, n)
+				if n.Else != nil {
+					m.Else = make([]ast.Statement, len(n.Else))
+					copy(m.Else, n.Else)
+				}
 				newnode = m
 			case *BreakStatement:
 				m := &BreakStatement{}
 				copier.Copy(m, n)
 				newnode = m
 			case *ContinueStatement:
-				m := &BreakStatement{}
+				m := &ContinueStatement{}
 				copier.Copy(m, n)
 				newnode = m
+			case *ArrayDeclaration:
+				m := &ArrayDeclaration{}
+				copier.Copy(m, n)
+				newnode = m
+			case *ArrayAccess:
+				m := &ArrayAccess{}
+				copier.Copy(m, n)
+				newnode = m
+			case *ArrayAssignment:
+				m := &ArrayAssignment{}
+				copier.Copy(m, n)
+				newnode = m
+			case *LocalDeclaration:
+				m := &LocalDeclaration{}
+				copier.Copy(m, n)
+				newnode = m
+			case *Assertion:
+				m := &Assertion{}
+				copier.Copy(m, n)
+				newnode = m
+			case *DebugBlock:
+				m := &DebugBlock{}
+				copier.Copy(m, n)
+				newnode = m
+			case *Sleep:
+				m := &Sleep{}
+				copier.Copy(m, n)
+				newnode = m
+			case *RawYololBlock:
+				m := &RawYololBlock{}
+				copier.Copy(m, n)
+				m.Lines = make([]*ast.Line, len(n.Lines))
+				copy(m.Lines, n.Lines)
+				m.Labels = make([]string, len(n.Labels))
+				copy(m.Labels, n.Labels)
+				newnode = m
 			default:
 				panic(fmt.Sprintf("Cannot copy unkown type %T", node))
 			}
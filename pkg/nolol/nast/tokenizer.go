@@ -10,6 +10,11 @@ import (
 func NewNololTokenizer() *ast.Tokenizer {
 	tok := ast.NewTokenizer()
 	tok.KeywordRegex = regexp.MustCompile("(?i)^\\b(if|else|end|then|goto|and|or|not|define|while|do|wait|include|macro|insert|break|continue)\\b")
-	tok.Symbols = append(tok.Symbols, []string{";", "$"}...)
+	tok.Symbols = append(tok.Symbols, []string{";", "$", "[", "]", "#", "@"}...)
+	// a colon followed by whitespace separates the label of a loop from the loop (name: while ...).
+	// A colon directly followed by a name is part of the name of a global variable
+	tok.Symbols = append(tok.Symbols, []string{": ", ":\t"}...)
+	// identifiers can be qualified with the namespace of an include (lib.name)
+	tok.IdentifierRegex = regexp.MustCompile("^:?[a-zA-Z]+[a-zA-Z0-9_]*(\\.[a-zA-Z]+[a-zA-Z0-9_]*)*")
 	return tok
 }
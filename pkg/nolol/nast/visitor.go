@@ -9,6 +9,19 @@ func (g *GoToLabelStatement) Accept(v ast.Visitor) error {
 	return v.Visit(g, ast.SingleVisit)
 }
 
+// Accept is used to implement Acceptor
+func (g *DynamicGoToStatement) Accept(v ast.Visitor) error {
+	err := v.Visit(g, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	g.Index, err = ast.AcceptChild(v, g.Index)
+	if err != nil {
+		return err
+	}
+	return v.Visit(g, ast.PostVisit)
+}
+
 // Accept is used to implement Acceptor
 func (p *Program) Accept(v ast.Visitor) error {
 	err := v.Visit(p, ast.PreVisit)
@@ -133,6 +146,154 @@ func (s *WhileLoop) Accept(v ast.Visitor) error {
 	return v.Visit(s, ast.PostVisit)
 }
 
+// Accept is used to implement Acceptor
+func (s *DoWhileLoop) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	repl, err := ast.AcceptChild(v, s.Block)
+	if err != nil {
+		return err
+	}
+	s.Block = repl.(*Block)
+	err = v.Visit(s, ast.InterVisit1)
+	if err != nil {
+		return err
+	}
+	s.Condition, err = ast.AcceptChild(v, s.Condition)
+	if err != nil {
+		return err
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *ForLoop) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.From, err = ast.AcceptChild(v, s.From)
+	if err != nil {
+		return err
+	}
+	err = v.Visit(s, ast.InterVisit1)
+	if err != nil {
+		return err
+	}
+	s.To, err = ast.AcceptChild(v, s.To)
+	if err != nil {
+		return err
+	}
+	err = v.Visit(s, ast.InterVisit2)
+	if err != nil {
+		return err
+	}
+	repl, err := ast.AcceptChild(v, s.Block)
+	s.Block = repl.(*Block)
+	if err != nil {
+		return err
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *CompileTimeIf) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.Condition, err = ast.AcceptChild(v, s.Condition)
+	if err != nil {
+		return err
+	}
+	err = v.Visit(s, ast.InterVisit1)
+	if err != nil {
+		return err
+	}
+	repl, err := ast.AcceptChild(v, s.IfBlock)
+	s.IfBlock = repl.(*Block)
+	if err != nil {
+		return err
+	}
+	if s.ElseBlock != nil {
+		err = v.Visit(s, ast.InterVisit2)
+		if err != nil {
+			return err
+		}
+		repl, err := ast.AcceptChild(v, s.ElseBlock)
+		s.ElseBlock = repl.(*Block)
+		if err != nil {
+			return err
+		}
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *SwitchStatement) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.Value, err = ast.AcceptChild(v, s.Value)
+	if err != nil {
+		return err
+	}
+	err = v.Visit(s, ast.InterVisit1)
+	if err != nil {
+		return err
+	}
+	for i := range s.Cases {
+		repl, err := ast.AcceptChild(v, s.Cases[i])
+		if err != nil {
+			return err
+		}
+		s.Cases[i] = repl.(*SwitchCase)
+	}
+	if s.Default != nil {
+		err = v.Visit(s, ast.InterVisit2)
+		if err != nil {
+			return err
+		}
+		repl, err := ast.AcceptChild(v, s.Default)
+		if err != nil {
+			return err
+		}
+		s.Default = repl.(*Block)
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *SwitchCase) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	for i := range s.Values {
+		err = v.Visit(s, i)
+		if err != nil {
+			return err
+		}
+		s.Values[i], err = ast.AcceptChild(v, s.Values[i])
+		if err != nil {
+			return err
+		}
+	}
+	err = v.Visit(s, ast.InterVisit1)
+	if err != nil {
+		return err
+	}
+	repl, err := ast.AcceptChild(v, s.Block)
+	if err != nil {
+		return err
+	}
+	s.Block = repl.(*Block)
+	return v.Visit(s, ast.PostVisit)
+}
+
 // Accept is used to implement Acceptor
 func (s *WaitDirective) Accept(v ast.Visitor) error {
 	err := v.Visit(s, ast.PreVisit)
@@ -144,6 +305,17 @@ func (s *WaitDirective) Accept(v ast.Visitor) error {
 		return err
 	}
 
+	if s.Timeout != nil {
+		err = v.Visit(s, ast.InterVisit2)
+		if err != nil {
+			return err
+		}
+		s.Timeout, err = ast.AcceptChild(v, s.Timeout)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = v.Visit(s, ast.InterVisit1)
 	if err != nil {
 		return err
@@ -154,6 +326,17 @@ func (s *WaitDirective) Accept(v ast.Visitor) error {
 		return err
 	}
 
+	if s.Else != nil {
+		err = v.Visit(s, ast.InterVisit3)
+		if err != nil {
+			return err
+		}
+		s.Else, err = ast.AcceptChildStatements(s, v, s.Else)
+		if err != nil {
+			return err
+		}
+	}
+
 	return v.Visit(s, ast.PostVisit)
 }
 
@@ -169,6 +352,15 @@ func (s *MacroDefinition) Accept(v ast.Visitor) error {
 		return err
 	}
 
+	if s.Expression != nil {
+		rv, err := ast.AcceptChild(v, s.Expression)
+		if err != nil {
+			return err
+		}
+		s.Expression = rv.(ast.Expression)
+		return v.Visit(s, ast.PostVisit)
+	}
+
 	rv, err := ast.AcceptChild(v, s.Block)
 	if err != nil {
 		return err
@@ -212,6 +404,11 @@ func (f *FuncCall) Accept(v ast.Visitor) error {
 	return v.Visit(f, ast.PostVisit)
 }
 
+// Accept is used to implement Acceptor
+func (s *ChipBoundary) Accept(v ast.Visitor) error {
+	return v.Visit(s, ast.SingleVisit)
+}
+
 // Accept is used to implement Acceptor
 func (s *BreakStatement) Accept(v ast.Visitor) error {
 	return v.Visit(s, ast.SingleVisit)
@@ -314,3 +511,134 @@ func AcceptExpressionList(parent ast.Node, v ast.Visitor, old []ast.Expression)
 	}
 	return old, nil
 }
+
+// Accept is used to implement Acceptor
+func (s *ArrayDeclaration) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	if s.Size != nil {
+		s.Size, err = ast.AcceptChild(v, s.Size)
+		if err != nil {
+			return err
+		}
+	}
+	if s.From != nil {
+		s.From, err = ast.AcceptChild(v, s.From)
+		if err != nil {
+			return err
+		}
+		err = v.Visit(s, ast.InterVisit1)
+		if err != nil {
+			return err
+		}
+		s.To, err = ast.AcceptChild(v, s.To)
+		if err != nil {
+			return err
+		}
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *ArrayAccess) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.Index, err = ast.AcceptChild(v, s.Index)
+	if err != nil {
+		return err
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *ArrayAssignment) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.Index, err = ast.AcceptChild(v, s.Index)
+	if err != nil {
+		return err
+	}
+	err = v.Visit(s, ast.InterVisit1)
+	if err != nil {
+		return err
+	}
+	s.Value, err = ast.AcceptChild(v, s.Value)
+	if err != nil {
+		return err
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *LocalDeclaration) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	if s.Value != nil {
+		s.Value, err = ast.AcceptChild(v, s.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *RawYololBlock) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.Lines, err = ast.AcceptChildLines(s, v, s.Lines)
+	if err != nil {
+		return err
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *Assertion) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.Condition, err = ast.AcceptChild(v, s.Condition)
+	if err != nil {
+		return err
+	}
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *DebugBlock) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	repl, err := ast.AcceptChild(v, s.Block)
+	if err != nil {
+		return err
+	}
+	s.Block = repl.(*Block)
+	return v.Visit(s, ast.PostVisit)
+}
+
+// Accept is used to implement Acceptor
+func (s *Sleep) Accept(v ast.Visitor) error {
+	err := v.Visit(s, ast.PreVisit)
+	if err != nil {
+		return err
+	}
+	s.Duration, err = ast.AcceptChild(v, s.Duration)
+	if err != nil {
+		return err
+	}
+	return v.Visit(s, ast.PostVisit)
+}
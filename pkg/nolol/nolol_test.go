@@ -1,6 +1,11 @@
 package nolol_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol"
@@ -111,3 +116,957 @@ func TestLineHandling(t *testing.T) {
 		t.Fatal("Wrong amount of lines after merging. Expected 8, but got: ", lines)
 	}
 }
+
+func TestVariableNamesByUsage(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"main": "rare = :x\nfrequent = 1\nfrequent++\n:o = frequent * frequent + rare",
+	}
+	conv := nolol.NewConverter()
+	prog, err := conv.ConvertFileEx("main", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	printed, _ := printer.Print(prog)
+	translations := conv.GetVariableTranslations()
+	if translations["a"] != "frequent" || translations["b"] != "rare" {
+		t.Fatalf("The most used variable did not receive the shortest name (%v):\n%s", translations, printed)
+	}
+	if !strings.Contains(printed, "b=:x a=1") {
+		t.Fatal("The generated code does not use the new names:\n", printed)
+	}
+}
+
+func TestOptimizationSelection(t *testing.T) {
+	conv := nolol.NewConverter()
+	err := conv.SetOptimizations([]string{"static"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := conv.ConvertFileEx("testProg2", testfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	printed, _ := printer.Print(prog)
+	if !strings.Contains(printed, "zzz=7") || !strings.Contains(printed, "what=\"ever\"") {
+		t.Fatal("Variables have been renamed, even though the optimization is disabled:\n", printed)
+	}
+	if conv.GetVariableTranslations()["zzz"] != "zzz" {
+		t.Fatal("Missing variable translation for zzz")
+	}
+
+	err = conv.SetOptimizations([]string{"doesnotexist"})
+	if err == nil {
+		t.Fatal("Setting an unknown optimization did not return an error")
+	}
+}
+
+func TestDynamicGoto(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"constant":   "define B = 1\ngoto [a, b][B]\na> :x=1\nb> :y=1",
+		"range":      "goto [a, b][2]\na> :x=1\nb> :y=1",
+		"string":     "goto [a, b][\"foo\"]\na> :x=1\nb> :y=1",
+		"sideeffect": "goto [a, b][i++]\na> :x=1\nb> :y=1",
+	}
+	conv := nolol.NewConverter()
+	prog, err := conv.ConvertFileEx("constant", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	printed, _ := printer.Print(prog)
+	if !strings.HasPrefix(printed, "goto 2 ") {
+		t.Fatal("Dynamic goto with constant index has not been replaced by a normal goto:\n", printed)
+	}
+
+	for _, file := range []string{"range", "string", "sideeffect"} {
+		_, err := nolol.NewConverter().ConvertFileEx(file, fs)
+		if err == nil {
+			t.Fatalf("Invalid dynamic goto in '%s' did not produce an error", file)
+		}
+	}
+}
+
+func TestSwitchJumpTable(t *testing.T) {
+	// the case-blocks are too long to fit on the lines of an if-chain. A jump-table must be used
+	long := strings.Repeat("x", 55)
+	fs := nolol.MemoryFileSystem{
+		"switch": "switch :v\ncase 1\n:out=\"a" + long + "\"\ncase 2, 4\n:out=\"b" + long + "\"\ncase 3\n:out=\"c" + long + "\"\ndefault\n:out=\"d" + long + "\"\nend\n:done=1",
+	}
+	prog, err := nolol.NewConverter().ConvertFileEx("switch", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &parser.Printer{}
+	code, err := printer.Print(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(code, "if ") {
+		t.Fatal("Switch has not been converted to a jump-table:\n", code)
+	}
+
+	expected := map[string]string{"0": "d", "1": "a", "2": "b", "3": "c", "4": "b", "5": "d"}
+	for input, out := range expected {
+		v, _ := vm.CreateFromSource(code)
+		v.SetVariable(":v", vm.VariableFromString(input))
+		v.Resume()
+		v.WaitForTermination()
+		result, _ := v.GetVariable(":out")
+		if result.String() != out+long {
+			t.Fatalf("Wrong case executed for input %s: %s", input, result.String())
+		}
+		if done, _ := v.GetVariable(":done"); done.Repr() != "1" {
+			t.Fatalf("Code after the switch was not executed for input %s", input)
+		}
+	}
+}
+
+func TestSwitchJumpTableSideEffect(t *testing.T) {
+	// the value of the switch must be evaluated only once, even if the jump-table contains multiple labels
+	long := strings.Repeat("x", 55)
+	fs := nolol.MemoryFileSystem{
+		"switch": "switch :v++\ncase 1\n:out=\"a" + long + "\"\ncase 2\n:out=\"b" + long + "\"\ncase 3\n:out=\"c" + long + "\"\ncase 4\n:out=\"d" + long + "\"\nend",
+	}
+	prog, err := nolol.NewConverter().ConvertFileEx("switch", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &parser.Printer{}
+	code, err := printer.Print(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(code, "if ") {
+		t.Fatal("Switch has not been converted to a jump-table:\n", code)
+	}
+
+	v, _ := vm.CreateFromSource(code)
+	v.SetVariable(":v", vm.VariableFromString("1"))
+	v.Resume()
+	v.WaitForTermination()
+	if result, _ := v.GetVariable(":v"); result.Repr() != "2" {
+		t.Fatalf("The switch-value has been incremented to %s instead of 2:\n%s", result.Repr(), code)
+	}
+	if result, _ := v.GetVariable(":out"); !strings.HasPrefix(result.String(), "a") {
+		t.Fatalf("Wrong case executed: %s", result.String())
+	}
+}
+
+func TestSwitchKeywordsAsVariables(t *testing.T) {
+	// switch, case and default are only keywords inside of a switch. Existing programs can still use them as variables
+	fs := nolol.MemoryFileSystem{
+		"vars": "switch = 2\ncase = switch + 1\nswitch switch\ncase 1\n:out = 1\ncase 2\ndefault = case\ncase++\n:out = default + case\ndefault\n:out = 3\nend",
+	}
+	prog, err := nolol.NewConverter().ConvertFileEx("vars", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &parser.Printer{}
+	code, err := printer.Print(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := vm.CreateFromSource(code)
+	v.Resume()
+	v.WaitForTermination()
+	if result, _ := v.GetVariable(":out"); result.Repr() != "7" {
+		t.Fatalf("Wrong result %s:\n%s", result.Repr(), code)
+	}
+}
+
+func TestForLoop(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"unrolled": "define N = 3\nfor i = 1 to N do\n:out += i\nend",
+		"runtime":  "for i = 1 to :n do\n:out += i\nend",
+		"labels":   "for i = 1 to 2 do\nlbl> :out += i\nend",
+		"assign":   "for i = 1 to 2 do\ni = 5\nend",
+		"strings":  "for i = \"a\" to 2 do\n:out += i\nend",
+		"vars":     "to = :a\nfor = to + 1\nfor i = to to for do\n:out += i\nend",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("unrolled", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if strings.TrimSpace(printed) != ":out+=1 :out+=2 :out+=3" {
+		t.Fatal("For-loop with constant bounds has not been unrolled:\n", printed)
+	}
+
+	prog, err = nolol.NewConverter().ConvertFileEx("runtime", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	if !strings.Contains(printed, "++a>:n") {
+		t.Fatal("For-loop with runtime bounds has not been converted to a while-loop:\n", printed)
+	}
+
+	// for and to are only keywords inside of the loop-header. Existing programs can still use them as variables
+	prog, err = nolol.NewConverter().ConvertFileEx("vars", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	v, _ := vm.CreateFromSource(printed)
+	v.SetVariable(":a", vm.VariableFromString("2"))
+	v.Resume()
+	v.WaitForTermination()
+	if result, _ := v.GetVariable(":out"); result.Repr() != "5" {
+		t.Fatalf("Wrong result %s:\n%s", result.Repr(), printed)
+	}
+
+	for _, file := range []string{"labels", "assign", "strings"} {
+		_, err := nolol.NewConverter().ConvertFileEx(file, fs)
+		if err == nil {
+			t.Fatalf("Invalid for-loop in '%s' did not produce an error", file)
+		}
+	}
+}
+
+func TestCompileTimeIf(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"variant":  "define V = 1\n#if V == 1\n:out = \"one\"\n#else\n:out = \"other\"\n#end",
+		"runtime":  "#if :x == 1\n:out = 1\n#end",
+		"toplevel": "#if 1\ndefine X = 2\n#end\n:out = X",
+		"nested":   "if :a then\n#if 1\ndefine X = 2\n#end\nend",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("variant", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if strings.TrimSpace(printed) != ":out=\"one\"" {
+		t.Fatal("Wrong block has been included:\n", printed)
+	}
+
+	conv := nolol.NewConverter()
+	def, err := nolol.ParseDefinition("v=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv.Define(def.Name, def.Value)
+	prog, err = conv.ConvertFileEx("variant", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	if strings.TrimSpace(printed) != ":out=\"other\"" {
+		t.Fatal("Definition has not been overridden:\n", printed)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("runtime", fs)
+	if err == nil {
+		t.Fatal("#if with a runtime-condition did not produce an error")
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("toplevel", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("nested", fs)
+	if err == nil {
+		t.Fatal("A definition inside of an #if inside of a block did not produce an error")
+	}
+
+	for _, invalid := range []string{"=5", "a=", "a b=1"} {
+		if _, err := nolol.ParseDefinition(invalid); err == nil {
+			t.Fatalf("Invalid definition '%s' did not produce an error", invalid)
+		}
+	}
+}
+
+func TestChips(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"chips":  ":a = 1\n#chip\n:b = 2",
+		"shared": "a = 1\n#chip\n:b = a",
+		"single": ":a = 1\n#chip\n",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	chips, err := nolol.NewConverter().ConvertChipsFileEx("chips", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"if :nolol_chip!=0 then goto 1 end :a=1 :nolol_chip=1 goto 1",
+		"if :nolol_chip!=1 then goto 1 end :b=2 :nolol_chip=0 goto 1",
+	}
+	if len(chips) != len(expected) {
+		t.Fatalf("Expected %d chips but got %d", len(expected), len(chips))
+	}
+	for i, chip := range chips {
+		printed, _ := printer.Print(chip)
+		if strings.TrimSpace(printed) != expected[i] {
+			t.Fatalf("Wrong code for chip %d:\n%s", i+1, printed)
+		}
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("chips", fs)
+	if err == nil {
+		t.Fatal("Converting a multi-chip program into a single program did not produce an error")
+	}
+
+	_, err = nolol.NewConverter().ConvertChipsFileEx("shared", fs)
+	if err == nil {
+		t.Fatal("Sharing a local variable between chips did not produce an error")
+	}
+
+	chips, err = nolol.NewConverter().ConvertChipsFileEx("single", fs)
+	if err != nil || len(chips) != 1 {
+		t.Fatal("Empty chips have not been removed")
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"main": "include \"lib\"\n:a = 1\nif :b then\n\t:c = 2\nend\ninsert set(:d)",
+		"lib":  "macro set(x)\n\tx = 3\nend",
+	}
+	converter := nolol.NewConverter()
+	prog, err := converter.ConvertFileEx("main", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	code, sm, err := converter.GenerateSourceMap(printer, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(code) != ":a=1 if :b then :c=2 end :d=3" {
+		t.Fatalf("Unexpected code: %s", code)
+	}
+
+	expect := func(column int, source string, line int, macros ...string) {
+		found := sm.Lookup(1, column)
+		if len(found) == 0 {
+			t.Fatalf("No mapping found for coloumn %d", column)
+		}
+		m := found[len(found)-1]
+		if m.Source != source || m.SourceLine != line {
+			t.Fatalf("Coloumn %d is mapped to %s:%d, but expected %s:%d", column, m.Source, m.SourceLine, source, line)
+		}
+		if len(m.Expansions) != len(macros) {
+			t.Fatalf("Coloumn %d has %d macro-expansions, but expected %d", column, len(m.Expansions), len(macros))
+		}
+		for i, macro := range macros {
+			if m.Expansions[i].Macro != macro {
+				t.Fatalf("Wrong macro-expansion for coloumn %d: %s", column, m.Expansions[i].Macro)
+			}
+		}
+	}
+
+	expect(1, "main", 2)
+	expect(6, "main", 3)
+	expect(17, "main", 4)
+	expect(26, "lib", 2, "set")
+
+	if len(sm.Lookup(1, 0)) != 4 {
+		t.Fatal("Not all mappings of the line have been returned")
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	cases := map[string]string{
+		"define a = 1\ndefine a = 2\n:out = a":                          "shadows an earlier definition",
+		"macro m()\n\t:a = 1\nend\n:b = 1":                              "The macro 'm' is never used",
+		"lbl> :a = 1":                                                   "The label 'lbl' is never used",
+		"x = 1\nwait x > 0":                                             "can never change",
+		"while 0 do\n\t:a = 1\nend":                                     "always false",
+		"x = 1\nmacro m()\n\tx = 2\nend\ninsert m()\n:out = x":          "local to the macro",
+		"lbl> :a = 1\nwait :b\ngoto lbl":                                "",
+		"macro m(x)\n\tx = 2\n\ty = 3\nend\ninsert m(:a)\ninsert m(:b)": "",
+	}
+	for prog, expected := range cases {
+		fs := nolol.MemoryFileSystem{
+			"main": prog,
+		}
+		converter := nolol.NewConverter()
+		_, err := converter.ConvertFileEx("main", fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warnings := converter.GetWarnings()
+		if expected == "" {
+			if len(warnings) != 0 {
+				t.Fatalf("Unexpected warnings for:\n%s\n%s", prog, warnings)
+			}
+			continue
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0].Message, expected) {
+			t.Fatalf("Expected one warning containing '%s' for:\n%s\nbut got: %s", expected, prog, warnings)
+		}
+	}
+}
+
+func TestNamespacedInclude(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"lib":     "include \"consts\"\nmacro set(x)\n\tx = VALUE\nend",
+		"consts":  "define VALUE = 5",
+		"main":    "define value = 1\ninclude \"lib\" as lib\ninsert lib.set(:a)\n:b = lib.VALUE + value",
+		"unknown": "include \"lib\" as lib\n:a = lib.other",
+		"hidden":  "include \"lib\" as lib\ninsert set(:a)",
+		"exprlib": "define FACTOR = 2\nmacro double(v) = v * FACTOR\nmacro quad(v) = double(double(v))",
+		"nested":  "include \"exprlib\" as lib\n:b = lib.quad(:a)",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("main", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if strings.TrimSpace(printed) != ":a=5 :b=6" {
+		t.Fatalf("Unexpected code: %s", printed)
+	}
+
+	prog, err = nolol.NewConverter().ConvertFileEx("nested", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	if strings.TrimSpace(printed) != ":b=:a*2*2" {
+		t.Fatalf("Unexpected code for nested expression-macros: %s", printed)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("unknown", fs)
+	if err == nil {
+		t.Fatal("Using an undefined qualified name did not produce an error")
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("hidden", fs)
+	if err == nil {
+		t.Fatal("Using a namespaced macro without its namespace did not produce an error")
+	}
+
+	dir, err := ioutil.TempDir("", "nolol-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "searched.nolol"), []byte("define X = 7"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converter := nolol.NewConverter()
+	converter.SetIncludePaths([]string{dir})
+	prog, err = converter.ConvertFileEx("main", nolol.MemoryFileSystem{
+		"main": "include \"searched.nolol\"\n:a = X",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	if strings.TrimSpace(printed) != ":a=7" {
+		t.Fatalf("Unexpected code: %s", printed)
+	}
+}
+
+func TestExpressionMacroErrors(t *testing.T) {
+	cases := map[string]string{
+		"macro m(a) = a * 2\ninsert m(:a)":                     "can only be used inside of expressions",
+		"macro m()\n\t:a = 1\nend\n:b = m()":                   "does not return a value",
+		"macro m() returns r\n\tr = 1\nend\nwait m() > 0":      "can only be used inside the statements of a line",
+		"macro m(a) returns a\n\ta = 1\nend\n:b = m(:c)":       "must be a local variable",
+		"macro m(a) = m(a) + 1\n:b = m(1)":                     "Macro-loop detected",
+		"macro m(a, b) = a + b\n:b = m(1)":                     "Wrong number of arguments",
+		"macro m(a) = a * 2\nwhile m(:a) < 10 do\n\t:a++\nend": "",
+	}
+	for prog, expected := range cases {
+		fs := nolol.MemoryFileSystem{
+			"main": prog,
+		}
+		converter := nolol.NewConverter()
+		_, err := converter.ConvertFileEx("main", fs)
+		if expected == "" {
+			if err != nil {
+				t.Fatalf("Unexpected error for:\n%s\n%s", prog, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected an error containing '%s' for:\n%s\nbut got: %v", expected, prog, err)
+		}
+	}
+}
+
+func TestArrayErrors(t *testing.T) {
+	cases := map[string]string{
+		":a = buf[1]":               "No array named 'buf' declared",
+		"array buf[4]\n:a = buf[4]": "out of range",
+		"array buf[:a]":             "known at compile-time",
+		"array buf[3 to 1]":         "at least one element",
+		"array buf[4]\nwhile buf[:a] do\n\t:b++\nend":                         "not in conditions of nolol-constructs",
+		"array buf[4]\nwait :b then buf[:a] = 1 end":                          "can only be used in the statements of a line",
+		"array buf[4]\nmacro m(arr, i)\n\tarr[i] = 1\nend\ninsert m(buf, :a)": "",
+		"array buf[4]\nmacro m(arr)\n\tarr[0] = 1\nend\ninsert m(1)":          "must be the name of an array",
+	}
+	for prog, expected := range cases {
+		fs := nolol.MemoryFileSystem{
+			"main": prog,
+		}
+		converter := nolol.NewConverter()
+		_, err := converter.ConvertFileEx("main", fs)
+		if expected == "" {
+			if err != nil {
+				t.Fatalf("Unexpected error for:\n%s\n%s", prog, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Expected an error containing '%s' for:\n%s\nbut got: %v", expected, prog, err)
+		}
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"unrolled": "outer: for i = 1 to 3 do\nwhile 1 do\nif :a then\nbreak outer\nend\ncontinue outer\nend\nend\n:out = 1",
+		"dowhile":  "do\nwhile :a do\n:a--\nend\n:b++\nwhile :b < 3\n:out = :b",
+		"unknown":  "while 1 do\nbreak outer\nend",
+		"nolabel":  "outer: :a = 1",
+		"nospace":  "outer:while 1 do\nbreak outer\nend",
+		"tab":      "outer:\twhile 1 do\nbreak outer\nend",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("unrolled", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if strings.Count(printed, "\n") != 3 {
+		t.Fatal("Labeled break and continue did not leave the unrolled loop:\n", printed)
+	}
+
+	prog, err = nolol.NewConverter().ConvertFileEx("dowhile", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	if !strings.Contains(printed, "if :b<3 then goto 1 end") {
+		t.Fatal("Do-while-loop has not been converted to a conditional goto at the end:\n", printed)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("tab", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []string{"unknown", "nolabel"} {
+		_, err := nolol.NewConverter().ConvertFileEx(file, fs)
+		if err == nil {
+			t.Fatalf("Invalid loop-label in '%s' did not produce an error", file)
+		}
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("nospace", fs)
+	if err == nil || !strings.Contains(err.Error(), "Expected a space between the ':' of the loop-label and the loop") || strings.Count(err.Error(), "Parser error") != 1 {
+		t.Fatal("Loop-label without a space did not produce the right error: ", err)
+	}
+}
+
+func TestLocalVariables(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"shadow": "x = 1\nif :a then\nlocal x = 2\n:b = x\nend\n:c = x",
+		"macro":  "macro m() returns r\nlocal r = 5\nend\n:out = m()",
+		"twice":  "if :a then\nlocal x\nlocal x\nend",
+		"global": "local :x = 1",
+		"reuse":  "if :a == 1 then\nlocal x = 5\n:b = x\nend\n:a++\nif :a == 2 then\nlocal y\ny++\n:c = y\nend",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("shadow", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if !strings.Contains(printed, ":b=b") || !strings.Contains(printed, ":c=a") {
+		t.Fatal("Local variable did not hide the variable of the program:\n", printed)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("macro", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// y reuses the variable of x and must not start with the value of x
+	prog, err = nolol.NewConverter().ConvertFileEx("reuse", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	v, _ := vm.CreateFromSource(printed)
+	v.SetVariable(":a", vm.VariableFromString("1"))
+	v.SetMaxExecutedLines(20)
+	v.Resume()
+	v.WaitForTermination()
+	if result, _ := v.GetVariable(":c"); result.Repr() != "1" {
+		t.Fatalf("Local without initial value started with the value of a previous local:\n%s", printed)
+	}
+
+	for _, file := range []string{"twice", "global"} {
+		_, err := nolol.NewConverter().ConvertFileEx(file, fs)
+		if err == nil {
+			t.Fatalf("Invalid local-declaration in '%s' did not produce an error", file)
+		}
+	}
+}
+
+func TestRawYolol(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"raw":      "x = :a > 1\nyolol\nif x then y=1 else y=0 end\nend\n:out = y",
+		"invalid":  "yolol\nwhile a do\nend",
+		"unclosed": "yolol\na=1",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("raw", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if !strings.Contains(printed, "\nif b then a=1 else a=0 end\n") {
+		t.Fatal("The yolol-block has been changed during conversion:\n", printed)
+	}
+
+	for _, file := range []string{"invalid", "unclosed"} {
+		_, err := nolol.NewConverter().ConvertFileEx(file, fs)
+		if err == nil {
+			t.Fatalf("Invalid yolol-block in '%s' did not produce an error", file)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"runtime":  "assert :a > 1, \"too small\"\ndebug\n:b = 1\nend\n:c = 2",
+		"constant": "define max = 3\nassert max > 5, \"max is too small\"",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("runtime", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if !strings.Contains(printed, nolol.AssertionVariable+"/=0") || !strings.Contains(printed, ":b=1") {
+		t.Fatal("Assertion or debug-block has not been included:\n", printed)
+	}
+
+	conv := nolol.NewConverter()
+	conv.SetRelease(true)
+	prog, err = conv.ConvertFileEx("runtime", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ = printer.Print(prog)
+	if printed != ":c=2" {
+		t.Fatal("Assertion or debug-block has not been removed in release-mode:\n", printed)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("constant", fs)
+	if err == nil || !strings.Contains(err.Error(), "max is too small") {
+		t.Fatal("Failing compile-time assertion did not produce an error: ", err)
+	}
+}
+
+func TestDecompile(t *testing.T) {
+	progs := map[string]string{
+		"fizzbuzz": `:out="" :number=0
+if :number>100 then goto 7 end
+if :number%3==0 and :number%5==0 then :out+="fizzbuzz " goto 6 end
+if :number%3==0 then :out+="fizz " goto 6 end
+if :number%5==0 then :out+="buzz " end
+:number++ goto 2`,
+		"jumps": `i=0 :out="" // comment
+:out+=abs(i-3)+" " i++ if i<5 then goto 2 end
+if i>10 then :x=1 else if i>5 then :x=2 else :x=3 end end
+j=0 :y=0 do=1
+:y+=j j++ if j%2 then goto 6 end
+if j<7 then goto 5 end
+goto 8+:skip
+:z=1 goto 30
+:z=2`,
+		"error": `:o=1/:zero :p=2
+:q=3`,
+	}
+	expected := map[string][]string{
+		"fizzbuzz": {"while :number <= 100 do", "line6> :number++\n"},
+		"jumps":    {"do_ = 1", "do\n", "while i < 5", "else if i > 5 then", "target = 8 + :skip", "if target < 2 then"},
+		"error":    {"$ :o = 1 / :zero; :p = 2 $\n"},
+	}
+	vars := []string{":out", ":number", ":x", ":y", ":z", ":o", ":p", ":q"}
+
+	for name, source := range progs {
+		yololProg, err := parser.NewParser().Parse(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompiled, err := nolol.NewDecompiler().Decompile(yololProg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nololCode, err := nolol.NewPrinter().Print(decompiled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, part := range expected[name] {
+			if !strings.Contains(nololCode, part) {
+				t.Fatalf("Decompiled '%s' does not contain '%s':\n%s", name, part, nololCode)
+			}
+		}
+
+		compiled, err := nolol.NewConverter().ConvertFileEx(name, nolol.MemoryFileSystem{name: nololCode})
+		if err != nil {
+			t.Fatal(err, "\n", nololCode)
+		}
+		printer := parser.Printer{}
+		recompiled, _ := printer.Print(compiled)
+
+		for _, skip := range []string{"0", "1"} {
+			results := make([]map[string]string, 2)
+			for i, code := range []string{source, recompiled} {
+				v, _ := vm.CreateFromSource(code)
+				v.SetVariable(":skip", vm.VariableFromString(skip))
+				v.SetMaxExecutedLines(1000)
+				// runtime-errors abort the current line and are otherwise ignored
+				v.SetErrorHandler(func(*vm.VM, error) bool {
+					return true
+				})
+				v.Resume()
+				v.WaitForTermination()
+				results[i] = make(map[string]string)
+				for _, variable := range vars {
+					if value, exists := v.GetVariable(variable); exists {
+						results[i][variable] = value.Repr()
+					}
+				}
+			}
+			for _, variable := range vars {
+				if results[0][variable] != results[1][variable] {
+					t.Fatalf("Decompiled '%s' computes %s=%s instead of %s:\n%s", name, variable, results[1][variable], results[0][variable], nololCode)
+				}
+			}
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"main": "a=1\nb=2 $\nc=3\n$ d=4\nlbl> e=5\nwait :x == 0\n:f=\"a long string that is rather long, to fill the line\"\n:g=\"another long string that also fills a line\"\n:h=time()\ngoto lbl",
+	}
+	conv := nolol.NewConverter()
+	chips, err := conv.ConvertChipsFileEx("main", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	explanations := conv.GetExplanations()
+	if len(explanations) != 1 || len(explanations[0].Lines) != len(chips[0].Lines) {
+		t.Fatal("There must be one explanation for every generated line")
+	}
+	explanation := explanations[0]
+	if explanation.LineCounterLength != 4 || explanation.MaxLineLength != 66 {
+		t.Fatalf("Wrong length of the line-counter: %d (max line-length %d)", explanation.LineCounterLength, explanation.MaxLineLength)
+	}
+
+	expected := []struct {
+		sources []int
+		reason  string
+	}{
+		{[]int{1, 2}, "ends with '$'"},
+		{[]int{3}, "next line starts with '$'"},
+		{[]int{4}, "next line has the label 'lbl'"},
+		{[]int{5}, "next line is a wait-directive"},
+		{[]int{6}, "ends with a wait-directive"},
+		{[]int{7}, "next line does not fit"},
+		{[]int{8, 9, 10}, ""},
+	}
+	for i, line := range explanation.Lines {
+		sources := []int{}
+		for _, source := range line.Sources {
+			sources = append(sources, source.Line)
+		}
+		if fmt.Sprint(sources) != fmt.Sprint(expected[i].sources) {
+			t.Fatalf("Line %d has been created from lines %v instead of %v", i+1, sources, expected[i].sources)
+		}
+		if !strings.Contains(line.Reason, expected[i].reason) || (expected[i].reason == "" && line.Reason != "") {
+			t.Fatalf("Wrong reason for line %d: '%s'", i+1, line.Reason)
+		}
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"timeout": "wait :x == 0 timeout 5 then :r = 1 else :r = 2 end\n:done = 1",
+		"sleep":   ":a = time()\nsleep(10)\n:b = time()",
+		"nosleep": "x = sleep(1)",
+		"block":   "wait :x == 0 timeout 5 then\n:r = 1\nelse\n:r = 2\nend\n:done = 1",
+	}
+	printer := &parser.Printer{}
+
+	prog, err := nolol.NewConverter().ConvertFileEx("timeout", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := printer.Print(prog)
+	// the wait blocks while :x is 0. The else-block runs if the timeout has been reached
+	expected := map[string]string{"0": "2", "1": "1"}
+	for input, out := range expected {
+		v, _ := vm.CreateFromSource(code)
+		v.SetVariable(":x", vm.VariableFromString(input))
+		v.Resume()
+		v.WaitForTermination()
+		if result, _ := v.GetVariable(":r"); result.Repr() != out {
+			t.Fatalf("Wrong block executed for :x=%s: %s\n%s", input, result.Repr(), code)
+		}
+		if done, _ := v.GetVariable(":done"); done.Repr() != "1" {
+			t.Fatalf("Code after the wait was not executed for :x=%s", input)
+		}
+	}
+
+	prog, err = nolol.NewConverter().ConvertFileEx("sleep", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ = printer.Print(prog)
+	v, _ := vm.CreateFromSource(code)
+	v.Resume()
+	v.WaitForTermination()
+	a, _ := v.GetVariable(":a")
+	b, _ := v.GetVariable(":b")
+	if passed := b.Number().Sub(a.Number()).IntPart(); passed < 10 || passed > 11 {
+		t.Fatalf("sleep(10) waited for %d lines:\n%s", passed, code)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("nosleep", fs)
+	if err == nil || !strings.Contains(err.Error(), "only be used as a statement") {
+		t.Fatal("Using sleep() in an expression did not produce an error: ", err)
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("block", fs)
+	if err == nil || !strings.Contains(err.Error(), "must be on the same line as the wait") || strings.Count(err.Error(), "Parser error") != 1 {
+		t.Fatal("Multi-line statements of a wait did not produce the right errors: ", err)
+	}
+}
+
+func TestPinnedLines(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"pinned":   ":a = 1\n:b = 2\n@line 5 start> :c = 3\n:d = 4\n@line 7 other>\ngoto start",
+		"toolate":  ":a = \"" + strings.Repeat("a", 55) + "\"\n:b = \"" + strings.Repeat("b", 55) + "\"\n@line 2 start> :c = 3",
+		"nolabel":  "@line 2 :c = 3",
+		"tooLarge": "@line 21 start> :c = 3",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	conv := nolol.NewConverter()
+	chips, err := conv.ConvertChipsFileEx("pinned", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(chips[0])
+	lines := strings.Split(printed, "\n")
+	if len(lines) != 7 || !strings.HasPrefix(lines[4], ":c=3") || lines[6] != "goto 5" {
+		t.Fatal("The pinned lines have not been placed at their line-numbers:\n", printed)
+	}
+	if len(conv.GetExplanations()[0].Lines) != len(chips[0].Lines) {
+		t.Fatal("There must be one explanation for every generated line, including the inserted ones")
+	}
+
+	_, err = nolol.NewConverter().ConvertFileEx("toolate", fs)
+	if err == nil || !strings.Contains(err.Error(), "can not be placed at line 2") {
+		t.Fatal("A pinned line that can not be placed did not produce an error: ", err)
+	}
+	_, err = nolol.NewConverter().ConvertFileEx("nolabel", fs)
+	if err == nil || !strings.Contains(err.Error(), "Expected a label") {
+		t.Fatal("A pinned line without a label did not produce an error: ", err)
+	}
+	_, err = nolol.NewConverter().ConvertFileEx("tooLarge", fs)
+	if err == nil || !strings.Contains(err.Error(), "between 1 and 20") {
+		t.Fatal("A line-number larger than 20 did not produce an error: ", err)
+	}
+}
+
+func TestOptimizationLevels(t *testing.T) {
+	fs := nolol.MemoryFileSystem{
+		"readable": "number = 1\nresult = number + 2\n:out = result",
+		// the first line of the loop is too long to share its line with the check of the condition
+		"loop": "i = 0\nstart = time()\nwhile i < 5 do\n:out = \"" + strings.Repeat("x", 50) + "\" + i\ni++\nend\n:lines = time() - start",
+	}
+	printer := &parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+
+	conv := nolol.NewConverter()
+	err := conv.SetOptimizationLevel("-O0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := conv.ConvertFileEx("readable", fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, _ := printer.Print(prog)
+	if printed != "number=1\nresult=number+2\n:out=result" {
+		t.Fatal("-O0 did not generate one readable line per nolol-line:\n", printed)
+	}
+
+	executed := make(map[string]int64)
+	for _, level := range []string{"s", "fast"} {
+		conv := nolol.NewConverter()
+		conv.SetOptimizationLevel(level)
+		prog, err := conv.ConvertFileEx("loop", fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := printer.Print(prog)
+		v, _ := vm.CreateFromSource(code)
+		v.Resume()
+		v.WaitForTermination()
+		if out, _ := v.GetVariable(":out"); out.String() != strings.Repeat("x", 50)+"4" {
+			t.Fatalf("Wrong result at level %s: %s\n%s", level, out.String(), code)
+		}
+		lines, _ := v.GetVariable(":lines")
+		executed[level] = lines.Number().IntPart()
+	}
+	if executed["fast"] >= executed["s"] {
+		t.Fatalf("-Ofast did not execute fewer lines than -Os: %d >= %d", executed["fast"], executed["s"])
+	}
+
+	err = nolol.NewConverter().SetOptimizationLevel("O3")
+	if err == nil {
+		t.Fatal("Setting an unknown optimization-level did not return an error")
+	}
+}
@@ -1,6 +1,8 @@
 package nolol
 
 import (
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
@@ -11,6 +13,10 @@ import (
 // Parser parses a nolol-program
 type Parser struct {
 	*parser.Parser
+	// the lines of the parsed source-code. Needed to hand the contents of yolol-blocks to the yolol-parser
+	source []string
+	// the number of blocks (of ifs, loops, macros etc.) the parser is currently inside of
+	blockDepth int
 }
 
 // NewParser creates and returns a nolol parser
@@ -37,6 +43,8 @@ func (p *Parser) SetFilename(name string) {
 // Parse is the entry point for parsing
 func (p *Parser) Parse(prog string) (*nast.Program, error) {
 	p.Reset()
+	p.blockDepth = 0
+	p.source = strings.Split(prog, "\n")
 	p.Tokenizer.Load(prog)
 	// Advance twice to fill CurrentToken and NextToken
 	p.Advance()
@@ -64,14 +72,24 @@ func (p *Parser) ParseProgram() *nast.Program {
 func (p *Parser) ParseNestableElement() nast.NestableElement {
 	p.Log()
 
+	compileif := p.ParseCompileTimeIf()
+	if compileif != nil {
+		return compileif
+	}
+
 	ifline := p.ParseMultilineIf()
 	if ifline != nil {
 		return ifline
 	}
 
-	whileline := p.ParseWhile()
-	if whileline != nil {
-		return whileline
+	loop := p.ParseLoop()
+	if loop != nil {
+		return loop
+	}
+
+	switchstmt := p.ParseSwitch()
+	if switchstmt != nil {
+		return switchstmt
 	}
 
 	block := p.ParseWaitDirective()
@@ -84,6 +102,31 @@ func (p *Parser) ParseNestableElement() nast.NestableElement {
 		return mIns
 	}
 
+	local := p.ParseLocalDeclaration()
+	if local != nil {
+		return local
+	}
+
+	raw := p.ParseRawYolol()
+	if raw != nil {
+		return raw
+	}
+
+	assertion := p.ParseAssertion()
+	if assertion != nil {
+		return assertion
+	}
+
+	debug := p.ParseDebugBlock()
+	if debug != nil {
+		return debug
+	}
+
+	sleep := p.ParseSleep()
+	if sleep != nil {
+		return sleep
+	}
+
 	return p.ParseStatementLine()
 }
 
@@ -91,6 +134,11 @@ func (p *Parser) ParseNestableElement() nast.NestableElement {
 func (p *Parser) ParseElement() nast.Element {
 	p.Log()
 
+	chip := p.ParseChipBoundary()
+	if chip != nil {
+		return chip
+	}
+
 	include := p.ParseInclude()
 	if include != nil {
 		return include
@@ -106,10 +154,32 @@ func (p *Parser) ParseElement() nast.Element {
 		return mDef
 	}
 
+	array := p.ParseArrayDeclaration()
+	if array != nil {
+		return array
+	}
+
 	// NestableElements are also elements
 	return p.ParseNestableElement()
 }
 
+// ParseChipBoundary parses a #chip-directive
+func (p *Parser) ParseChipBoundary() nast.Element {
+	p.Log()
+	if !p.IsCurrent(ast.TypeSymbol, "#") || p.NextToken.Type != ast.TypeID || strings.ToLower(p.NextToken.Value) != "chip" {
+		return nil
+	}
+	boundary := &nast.ChipBoundary{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+	p.Advance()
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+	return boundary
+}
+
 // ParseInclude parses an include directive
 func (p *Parser) ParseInclude() *nast.IncludeDirective {
 	p.Log()
@@ -127,6 +197,15 @@ func (p *Parser) ParseInclude() *nast.IncludeDirective {
 	}
 	incl.File = p.CurrentToken.Value
 	p.Advance()
+	if p.isContextualKeyword("as") {
+		p.Advance()
+		if !p.IsCurrentType(ast.TypeID) || strings.Contains(p.CurrentToken.Value, ".") || strings.HasPrefix(p.CurrentToken.Value, ":") {
+			p.ErrorCurrent("Expected a name for the namespace after 'as'")
+			return incl
+		}
+		incl.Namespace = p.CurrentToken.Value
+		p.Advance()
+	}
 	if !p.IsCurrentType(ast.TypeEOF) {
 		p.Expect(ast.TypeNewline, "")
 	}
@@ -168,6 +247,30 @@ func (p *Parser) ParseMacroDefinition() *nast.MacroDefinition {
 
 	p.Expect(ast.TypeSymbol, ")")
 
+	// expression-macros consist of a single expression and can be used inside of expressions
+	if p.IsCurrent(ast.TypeSymbol, "=") {
+		p.Advance()
+		mdef.Expression = p.This.ParseExpression()
+		if mdef.Expression == nil {
+			p.ErrorCurrent("Expected an expression after the '='")
+		}
+		if !p.IsCurrentType(ast.TypeEOF) {
+			p.Expect(ast.TypeNewline, "")
+		}
+		return mdef
+	}
+
+	// block-macros with a result-variable can also be used inside of expressions
+	if p.IsCurrent(ast.TypeID, "returns") {
+		p.Advance()
+		if !p.IsCurrentType(ast.TypeID) || strings.HasPrefix(p.CurrentToken.Value, ":") {
+			p.ErrorCurrent("Expected the name of a local variable after 'returns'")
+		} else {
+			mdef.Result = p.CurrentToken.Value
+			p.Advance()
+		}
+	}
+
 	p.Expect(ast.TypeNewline, "")
 
 	mdef.Block = p.ParseBlock(func() bool {
@@ -213,11 +316,19 @@ func (p *Parser) ParseStatementLine() *nast.StatementLine {
 		Position: p.CurrentToken.Position,
 	}
 
+	// get the pinned line-number if it exists
+	pinned := p.IsCurrent(ast.TypeSymbol, "@")
+	if pinned {
+		ret.PinnedLine = p.parseLinePin()
+	}
+
 	// get line-label if it exists
 	if p.IsCurrentType(ast.TypeID) && (p.NextToken.Type == ast.TypeSymbol && p.NextToken.Value == ">") {
 		ret.Label = strings.ToLower(p.CurrentToken.Value)
 		p.Advance()
 		p.Advance()
+	} else if pinned {
+		p.ErrorCurrent("Expected a label after '@line <number>'")
 	}
 
 	// this line has no statements, only a comment
@@ -280,7 +391,29 @@ func (p *Parser) ParseStatementLine() *nast.StatementLine {
 	return &ret
 }
 
-// ParseWaitDirective parses a NOLOL wait-statement
+// parseLinePin parses the line-number of a pinned line (@line N)
+func (p *Parser) parseLinePin() int {
+	start := p.CurrentToken.Position
+	p.Advance()
+	if !p.isContextualKeyword("line") {
+		p.ErrorCurrent("Expected 'line' after '@'")
+		return 0
+	}
+	p.Advance()
+	if !p.IsCurrentType(ast.TypeNumber) {
+		p.ErrorCurrent("Expected a line-number after '@line'")
+		return 0
+	}
+	line, err := strconv.Atoi(p.CurrentToken.Value)
+	if err != nil || line < 1 || line > 20 {
+		p.Error("The line-number of '@line' must be a whole number between 1 and 20", start, p.CurrentToken.Position.Add(len(p.CurrentToken.Value)))
+		line = 0
+	}
+	p.Advance()
+	return line
+}
+
+// ParseWaitDirective parses a NOLOL wait-statement (wait cond [timeout n] [then statements] [else statements] end)
 func (p *Parser) ParseWaitDirective() *nast.WaitDirective {
 	p.Log()
 	if !p.IsCurrent(ast.TypeKeyword, "wait") {
@@ -293,37 +426,92 @@ func (p *Parser) ParseWaitDirective() *nast.WaitDirective {
 
 	st.Condition = p.This.ParseExpression()
 	if st.Condition == nil {
-		p.ErrorCurrent("Expected an expression after 'block'")
+		p.ErrorCurrent("Expected an expression after 'wait'")
 	}
 
+	if p.isContextualKeyword("timeout") {
+		p.Advance()
+		st.Timeout = p.This.ParseExpression()
+		if st.Timeout == nil {
+			p.ErrorCurrent("Expected an expression after 'timeout'")
+		}
+	}
+
+	hasBlock := false
 	if p.IsCurrent(ast.TypeKeyword, "then") {
 		p.Advance()
+		hasBlock = true
+		st.Statements = p.parseWaitStatements()
+	}
 
-		st.Statements = make([]ast.Statement, 0)
-		stmt := p.This.ParseStatement()
-		// at this point, the line must at least have one statement
-		if stmt != nil {
-			st.Statements = append(st.Statements, stmt)
-		} else {
-			p.ErrorCurrent("Expected a statement")
+	if st.Timeout != nil && p.IsCurrent(ast.TypeKeyword, "else") {
+		p.Advance()
+		hasBlock = true
+		st.Else = p.parseWaitStatements()
+	}
+
+	if hasBlock {
+		p.Expect(ast.TypeKeyword, "end")
+	}
+
+	return st
+}
+
+// parseWaitStatements parses the ;-separated statements of the then- or else-part of a wait
+func (p *Parser) parseWaitStatements() []ast.Statement {
+	stmts := make([]ast.Statement, 0)
+	if p.IsCurrentType(ast.TypeNewline) {
+		p.ErrorCurrent("The statements of a wait must be on the same line as the wait (separated by ';')")
+		// skip the rest of the wait (including an else-part), to avoid follow-up errors
+		for !p.IsCurrentType(ast.TypeEOF) && !p.IsCurrent(ast.TypeKeyword, "end") {
 			p.Advance()
-			return st
 		}
+		return stmts
+	}
+	stmt := p.This.ParseStatement()
+	// at this point, the line must at least have one statement
+	if stmt != nil {
+		stmts = append(stmts, stmt)
+	} else {
+		p.ErrorCurrent("Expected a statement")
+		p.Advance()
+		return stmts
+	}
 
-		for p.IsCurrent(ast.TypeSymbol, ";") {
-			p.Advance()
-			stmt = p.This.ParseStatement()
-			if stmt != nil {
-				st.Statements = append(st.Statements, stmt)
-			} else {
-				p.ErrorCurrent(("Expected a statement after ';'"))
-			}
+	for p.IsCurrent(ast.TypeSymbol, ";") {
+		p.Advance()
+		stmt = p.This.ParseStatement()
+		if stmt != nil {
+			stmts = append(stmts, stmt)
+		} else {
+			p.ErrorCurrent(("Expected a statement after ';'"))
 		}
+	}
+	return stmts
+}
 
-		p.Expect(ast.TypeKeyword, "end")
+// ParseSleep parses the sleep-builtin (sleep(n))
+func (p *Parser) ParseSleep() *nast.Sleep {
+	p.Log()
+	if !p.isContextualKeyword("sleep") || p.NextToken.Type != ast.TypeSymbol || p.NextToken.Value != "(" {
+		return nil
+	}
+	call := p.ParseFuncCall()
+	sleep := &nast.Sleep{
+		Position: call.Position,
+	}
+	if len(call.Arguments) != 1 {
+		p.Error("sleep() takes exactly one argument (the number of lines to wait)", call.Start(), call.End())
+		if len(call.Arguments) == 0 {
+			return sleep
+		}
 	}
+	sleep.Duration = call.Arguments[0]
 
-	return st
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+	return sleep
 }
 
 // ParseDefinition parses a constant declaration
@@ -354,6 +542,195 @@ func (p *Parser) ParseDefinition() *nast.Definition {
 	return decl
 }
 
+// ParseArrayDeclaration parses the declaration of an array (array name[size] or array name[from to to])
+func (p *Parser) ParseArrayDeclaration() *nast.ArrayDeclaration {
+	p.Log()
+	if !p.isContextualKeyword("array") || p.NextToken.Type != ast.TypeID {
+		return nil
+	}
+	decl := &nast.ArrayDeclaration{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+	decl.Name = p.CurrentToken.Value
+	p.Advance()
+	p.Expect(ast.TypeSymbol, "[")
+	size := p.This.ParseExpression()
+	if size == nil {
+		p.ErrorCurrent("Expected the size of the array")
+	}
+	if p.isContextualKeyword("to") {
+		p.Advance()
+		decl.From = size
+		decl.To = p.This.ParseExpression()
+		if decl.To == nil {
+			p.ErrorCurrent("Expected the last index of the array")
+		}
+	} else {
+		decl.Size = size
+	}
+	p.Expect(ast.TypeSymbol, "]")
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+	return decl
+}
+
+// ParseLocalDeclaration parses the declaration of a block-local variable (local name or local name = value)
+func (p *Parser) ParseLocalDeclaration() *nast.LocalDeclaration {
+	p.Log()
+	if !p.isContextualKeyword("local") || p.NextToken.Type != ast.TypeID {
+		return nil
+	}
+	decl := &nast.LocalDeclaration{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+	if strings.HasPrefix(p.CurrentToken.Value, ":") {
+		p.ErrorCurrent("Global variables can not be declared as local")
+	}
+	decl.Name = p.CurrentToken.Value
+	p.Advance()
+	if p.IsCurrent(ast.TypeSymbol, "=") {
+		p.Advance()
+		decl.Value = p.This.ParseExpression()
+		if decl.Value == nil {
+			p.ErrorCurrent("Expected the initial value of the variable")
+		}
+	}
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+	return decl
+}
+
+var rawLabelRegex = regexp.MustCompile("^\\s*([a-zA-Z][a-zA-Z0-9_]*)>([^=]|$)")
+
+// ParseRawYolol parses a block of yolol-code (yolol <newline> ... end). The lines of the block are parsed by the yolol-parser.
+// Lines inside the block can start with a line-label (label>)
+func (p *Parser) ParseRawYolol() *nast.RawYololBlock {
+	p.Log()
+	if !p.isContextualKeyword("yolol") || p.NextToken.Type != ast.TypeNewline {
+		return nil
+	}
+	block := &nast.RawYololBlock{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+
+	// the block ends with a line that consists only of "end"
+	for !p.IsCurrentType(ast.TypeNewline) || p.NextToken.Type != ast.TypeKeyword || strings.ToLower(p.NextToken.Value) != "end" {
+		if p.IsCurrentType(ast.TypeEOF) {
+			p.ErrorCurrent("Expected 'end' at the end of the yolol-block")
+			return block
+		}
+		p.Advance()
+	}
+	p.Advance()
+	block.EndPosition = p.CurrentToken.Position.Add(len("end"))
+	endline := p.CurrentToken.Position.Line
+	p.Advance()
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+
+	// the lines of the block are prefixed with empty lines. This way the positions of the parsed code are correct
+	first := block.Position.Line
+	lines := make([]string, 0, endline-1)
+	for i := 0; i < first; i++ {
+		lines = append(lines, "")
+	}
+	for _, line := range p.source[first : endline-1] {
+		label := ""
+		if match := rawLabelRegex.FindStringSubmatchIndex(line); match != nil {
+			label = strings.ToLower(line[match[2]:match[3]])
+			// replace the label by whitespace, to keep the columns of the code intact
+			line = strings.Repeat(" ", match[3]+1) + line[match[3]+1:]
+		}
+		block.Labels = append(block.Labels, label)
+		lines = append(lines, line)
+	}
+
+	yp := parser.NewParser()
+	yp.Tokenizer.SetFilename(block.Position.File)
+	parsed, err := yp.Parse(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		p.Errors = append(p.Errors, err.(parser.Errors)...)
+		return block
+	}
+	block.Lines = parsed.Lines[first:]
+	return block
+}
+
+// the tokens that can follow a variable-name at the start of a statement
+var statementSymbols = map[string]bool{"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true, "++": true, "--": true, ">": true}
+
+// isContextualKeyword returns true if the current token is the given contextual keyword.
+// Contextual keywords (like "switch" or "array") are not reserved by the tokenizer, as this would break existing programs that use them as variable-names.
+// Instead they are treated as keywords only at the positions where they are expected
+func (p *Parser) isContextualKeyword(name string) bool {
+	return p.IsCurrentType(ast.TypeID) && strings.ToLower(p.CurrentToken.Value) == name
+}
+
+// startsContextualStatement returns true if the current token is the given contextual keyword
+// and it is not the variable of an assignment (like "switch = 1") or a line-label
+func (p *Parser) startsContextualStatement(name string) bool {
+	return p.isContextualKeyword(name) && !(p.NextToken.Type == ast.TypeSymbol && statementSymbols[p.NextToken.Value])
+}
+
+// ParseAssertion parses an assertion (assert condition or assert condition, "message")
+func (p *Parser) ParseAssertion() *nast.Assertion {
+	p.Log()
+	if !p.startsContextualStatement("assert") || p.NextToken.Type == ast.TypeNewline || p.NextToken.Type == ast.TypeEOF {
+		return nil
+	}
+	assertion := &nast.Assertion{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+	assertion.Condition = p.This.ParseExpression()
+	if assertion.Condition == nil {
+		p.ErrorCurrent("Expected the condition of the assertion")
+		return assertion
+	}
+	if p.IsCurrent(ast.TypeSymbol, ",") {
+		p.Advance()
+		if !p.IsCurrentType(ast.TypeString) {
+			p.ErrorCurrent("Expected the message of the assertion (a string)")
+			return assertion
+		}
+		assertion.Message = p.CurrentToken.Value
+		p.Advance()
+	}
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+	return assertion
+}
+
+// ParseDebugBlock parses a block of code, that is only included if the program is not compiled as release (debug <newline> ... end)
+func (p *Parser) ParseDebugBlock() *nast.DebugBlock {
+	p.Log()
+	if !p.isContextualKeyword("debug") || p.NextToken.Type != ast.TypeNewline {
+		return nil
+	}
+	debug := &nast.DebugBlock{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+	p.Advance()
+
+	debug.Block = p.ParseBlock(func() bool {
+		return p.IsCurrent(ast.TypeKeyword, "end")
+	})
+
+	p.Expect(ast.TypeKeyword, "end")
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+	return debug
+}
+
 // ParseMultilineIf parses a nolol-style multiline if
 func (p *Parser) ParseMultilineIf() nast.Element {
 	p.Log()
@@ -414,10 +791,102 @@ func (p *Parser) ParseMultilineIf() nast.Element {
 	return &mlif
 }
 
+// loopKeywords are the keywords that start a loop, prefixed with the colon of a loop-label
+var loopKeywords = map[string]bool{":while": true, ":do": true, ":for": true}
+
+// ParseLoop parses any kind of loop, including an optional label (name: while ...)
+func (p *Parser) ParseLoop() nast.Element {
+	p.Log()
+	label := ""
+	if p.IsCurrentType(ast.TypeID) && !strings.HasPrefix(p.CurrentToken.Value, ":") {
+		next := p.NextToken
+		if next.Type == ast.TypeSymbol && strings.TrimSpace(next.Value) == ":" {
+			label = strings.ToLower(p.CurrentToken.Value)
+			p.Advance()
+			p.Advance()
+		} else if next.Type == ast.TypeID && !p.NextWouldBeWhitespace && loopKeywords[strings.ToLower(next.Value)] {
+			// without the space, the colon and the loop-keyword are read as the name of a global variable (name:while)
+			label = strings.ToLower(p.CurrentToken.Value)
+			p.Advance()
+			p.ErrorCurrent("Expected a space between the ':' of the loop-label and the loop")
+			// continue as if the space was there
+			p.CurrentToken = &ast.Token{
+				Type:     ast.TypeKeyword,
+				Value:    strings.ToLower(next.Value[1:]),
+				Position: next.Position.Add(1),
+			}
+		}
+	}
+
+	var loop nast.Element
+	if whileloop := p.ParseWhile(); whileloop != nil {
+		whileloop.Label = label
+		loop = whileloop
+	} else if doloop := p.ParseDoWhile(); doloop != nil {
+		doloop.Label = label
+		loop = doloop
+	} else if forloop := p.ParseFor(); forloop != nil {
+		forloop.Label = label
+		loop = forloop
+	}
+
+	if loop == nil && label != "" {
+		p.ErrorCurrent("Expected a loop after the label")
+	}
+	return loop
+}
+
+// ParseDoWhile parses a loop that checks its condition after every iteration (do ... while condition)
+func (p *Parser) ParseDoWhile() *nast.DoWhileLoop {
+	p.Log()
+	if !p.IsCurrent(ast.TypeKeyword, "do") {
+		return nil
+	}
+	loop := &nast.DoWhileLoop{
+		Position: p.CurrentToken.Position,
+		Block: &nast.Block{
+			Elements: []nast.NestableElement{},
+		},
+	}
+	p.Advance()
+	p.Expect(ast.TypeNewline, "")
+
+	for {
+		block := p.ParseBlock(func() bool {
+			return p.IsCurrent(ast.TypeKeyword, "while")
+		})
+		loop.Block.Elements = append(loop.Block.Elements, block.Elements...)
+
+		whilePosition := p.Expect(ast.TypeKeyword, "while")
+		condition := p.This.ParseExpression()
+		if condition == nil {
+			p.ErrorCurrent("No expression found as loop-condition")
+			return loop
+		}
+
+		// the while belongs to a nested while-loop and not to this loop
+		if p.IsCurrent(ast.TypeKeyword, "do") {
+			loop.Block.Elements = append(loop.Block.Elements, p.parseWhileBody(&nast.WhileLoop{
+				Position:  whilePosition,
+				Condition: condition,
+			}))
+			continue
+		}
+
+		loop.Condition = condition
+		break
+	}
+
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+	return loop
+}
+
 // ParseWhile pasres a nolol while
-func (p *Parser) ParseWhile() nast.Element {
+func (p *Parser) ParseWhile() *nast.WhileLoop {
 	p.Log()
-	loop := nast.WhileLoop{
+	loop := &nast.WhileLoop{
 		Position: p.CurrentToken.Position,
 	}
 	if !p.IsCurrent(ast.TypeKeyword, "while") {
@@ -430,6 +899,11 @@ func (p *Parser) ParseWhile() nast.Element {
 		p.ErrorCurrent("No expression found as loop-condition")
 	}
 
+	return p.parseWhileBody(loop)
+}
+
+// parseWhileBody parses the part of a while-loop after the condition
+func (p *Parser) parseWhileBody(loop *nast.WhileLoop) *nast.WhileLoop {
 	p.Expect(ast.TypeKeyword, "do")
 	p.Expect(ast.TypeNewline, "")
 
@@ -443,7 +917,180 @@ func (p *Parser) ParseWhile() nast.Element {
 		p.Expect(ast.TypeNewline, "")
 	}
 
-	return &loop
+	return loop
+}
+
+// ParseCompileTimeIf parses a #if-directive
+// As the contents of the blocks may be definitions, the blocks can contain any elements
+func (p *Parser) ParseCompileTimeIf() nast.Element {
+	p.Log()
+	if !p.IsCurrent(ast.TypeSymbol, "#") || p.NextToken.Type != ast.TypeKeyword || strings.ToLower(p.NextToken.Value) != "if" {
+		return nil
+	}
+	cif := nast.CompileTimeIf{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+	p.Advance()
+
+	cif.Condition = p.This.ParseExpression()
+	if cif.Condition == nil {
+		p.ErrorCurrent("No expression found as condition of #if")
+	}
+	p.Expect(ast.TypeNewline, "")
+
+	isDirective := func(keyword string) bool {
+		return p.IsCurrent(ast.TypeSymbol, "#") && p.NextToken.Type == ast.TypeKeyword && strings.ToLower(p.NextToken.Value) == keyword
+	}
+	parseElements := func() *nast.Block {
+		block := &nast.Block{
+			Elements: make([]nast.NestableElement, 0),
+		}
+		for p.HasNext() && !isDirective("else") && !isDirective("end") {
+			// definitions, macros and includes are only allowed on the top-level, even if they are inside an #if
+			if p.blockDepth > 0 {
+				block.Elements = append(block.Elements, p.ParseNestableElement())
+			} else {
+				block.Elements = append(block.Elements, p.ParseElement())
+			}
+		}
+		return block
+	}
+
+	cif.IfBlock = parseElements()
+
+	if isDirective("else") {
+		p.Advance()
+		p.Advance()
+		p.Expect(ast.TypeNewline, "")
+		cif.ElseBlock = parseElements()
+	}
+
+	if !isDirective("end") {
+		p.ErrorCurrent("Expected #end")
+		return &cif
+	}
+	p.Advance()
+	p.Advance()
+
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+
+	return &cif
+}
+
+// ParseFor parses a nolol for-loop
+func (p *Parser) ParseFor() *nast.ForLoop {
+	p.Log()
+	if !p.startsContextualStatement("for") || p.NextToken.Type != ast.TypeID {
+		return nil
+	}
+	loop := &nast.ForLoop{
+		Position: p.CurrentToken.Position,
+	}
+	p.Advance()
+
+	if !p.IsCurrentType(ast.TypeID) {
+		p.ErrorCurrent("Expected a variable-name after the for keyword")
+	}
+	loop.Variable = p.CurrentToken.Value
+	p.Advance()
+
+	p.Expect(ast.TypeSymbol, "=")
+
+	loop.From = p.This.ParseExpression()
+	if loop.From == nil {
+		p.ErrorCurrent("No expression found as start-value of the loop")
+	}
+
+	if p.isContextualKeyword("to") {
+		p.Advance()
+	} else {
+		p.ErrorCurrent("Expected 'to' after the start-value of the loop")
+	}
+
+	loop.To = p.This.ParseExpression()
+	if loop.To == nil {
+		p.ErrorCurrent("No expression found as end-value of the loop")
+	}
+
+	p.Expect(ast.TypeKeyword, "do")
+	p.Expect(ast.TypeNewline, "")
+
+	loop.Block = p.ParseBlock(func() bool {
+		return p.IsCurrent(ast.TypeKeyword, "end")
+	})
+
+	p.Expect(ast.TypeKeyword, "end")
+
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+
+	return loop
+}
+
+// ParseSwitch parses a nolol switch-statement
+func (p *Parser) ParseSwitch() nast.Element {
+	p.Log()
+	if !p.startsContextualStatement("switch") || p.NextToken.Type == ast.TypeNewline || p.NextToken.Type == ast.TypeEOF {
+		return nil
+	}
+	switchstmt := nast.SwitchStatement{
+		Position: p.CurrentToken.Position,
+		Cases:    make([]*nast.SwitchCase, 0),
+	}
+	p.Advance()
+
+	switchstmt.Value = p.This.ParseExpression()
+	if switchstmt.Value == nil {
+		p.ErrorCurrent("No expression found as switch-value")
+	}
+	p.Expect(ast.TypeNewline, "")
+
+	isCaseEnd := func() bool {
+		return p.startsContextualStatement("case") || p.startsContextualStatement("default") || p.IsCurrent(ast.TypeKeyword, "end")
+	}
+
+	for p.startsContextualStatement("case") {
+		switchcase := &nast.SwitchCase{
+			Position: p.CurrentToken.Position,
+			Values:   make([]ast.Expression, 0, 1),
+		}
+		p.Advance()
+		for {
+			value := p.This.ParseExpression()
+			if value == nil {
+				p.ErrorCurrent("No expression found as case-value")
+				break
+			}
+			switchcase.Values = append(switchcase.Values, value)
+			if !p.IsCurrent(ast.TypeSymbol, ",") {
+				break
+			}
+			p.Advance()
+		}
+		p.Expect(ast.TypeNewline, "")
+		switchcase.Block = p.ParseBlock(isCaseEnd)
+		switchstmt.Cases = append(switchstmt.Cases, switchcase)
+	}
+
+	if p.startsContextualStatement("default") {
+		p.Advance()
+		p.Expect(ast.TypeNewline, "")
+		switchstmt.Default = p.ParseBlock(func() bool {
+			return p.IsCurrent(ast.TypeKeyword, "end")
+		})
+	}
+
+	p.Expect(ast.TypeKeyword, "end")
+
+	if !p.IsCurrentType(ast.TypeEOF) {
+		p.Expect(ast.TypeNewline, "")
+	}
+
+	return &switchstmt
 }
 
 // ParseIf overrides and disables the old yolol-style inline ifs
@@ -456,6 +1103,10 @@ func (p *Parser) ParseIf() ast.Statement {
 // ParseBlock parse lines until stop() returns true
 func (p *Parser) ParseBlock(stop func() bool) *nast.Block {
 	p.Log()
+	p.blockDepth++
+	defer func() {
+		p.blockDepth--
+	}()
 	elements := make([]nast.NestableElement, 0)
 	for p.HasNext() && !stop() {
 		element := p.ParseNestableElement()
@@ -475,6 +1126,10 @@ func (p *Parser) ParseGoto() ast.Statement {
 	if p.IsCurrent(ast.TypeKeyword, "goto") {
 		p.Advance()
 
+		if p.IsCurrent(ast.TypeSymbol, "[") {
+			return p.ParseDynamicGoto()
+		}
+
 		stmt := &nast.GoToLabelStatement{
 			Position: p.CurrentToken.Position,
 			Label:    strings.ToLower(p.CurrentToken.Value),
@@ -491,6 +1146,40 @@ func (p *Parser) ParseGoto() ast.Statement {
 	return nil
 }
 
+// ParseDynamicGoto parses the part of a dynamic goto that follows the goto-keyword: [label1, label2][index]
+func (p *Parser) ParseDynamicGoto() ast.Statement {
+	p.Log()
+	stmt := &nast.DynamicGoToStatement{
+		Position: p.PrevToken.Position,
+		Labels:   make([]string, 0),
+	}
+	p.Expect(ast.TypeSymbol, "[")
+	for {
+		if !p.IsCurrentType(ast.TypeID) {
+			p.ErrorCurrent("Expected a line-label")
+			return stmt
+		}
+		stmt.Labels = append(stmt.Labels, strings.ToLower(p.CurrentToken.Value))
+		p.Advance()
+		if !p.IsCurrent(ast.TypeSymbol, ",") {
+			break
+		}
+		p.Advance()
+	}
+	p.Expect(ast.TypeSymbol, "]")
+	p.Expect(ast.TypeSymbol, "[")
+	stmt.Index = p.This.ParseExpression()
+	if stmt.Index == nil {
+		p.ErrorCurrent("Expected an expression as index of the dynamic goto")
+		stmt.Index = &ast.NumberConstant{
+			Position: p.CurrentToken.Position,
+			Value:    "0",
+		}
+	}
+	p.Expect(ast.TypeSymbol, "]")
+	return stmt
+}
+
 // ParseFuncCall parse a function call
 func (p *Parser) ParseFuncCall() *nast.FuncCall {
 	p.Log()
@@ -531,6 +1220,10 @@ func (p *Parser) ParseSingleExpression() ast.Expression {
 	if funccall != nil {
 		return funccall
 	}
+	access := p.ParseArrayAccess()
+	if access != nil {
+		return access
+	}
 	return p.Parser.ParseSingleExpression()
 }
 
@@ -545,9 +1238,71 @@ func (p *Parser) ParseStatement() ast.Statement {
 	if continuestmt != nil {
 		return continuestmt
 	}
+	arrayassignment := p.ParseArrayAssignment()
+	if arrayassignment != nil {
+		return arrayassignment
+	}
 	return p.Parser.ParseStatement()
 }
 
+// ParseArrayAccess parses the access to an element of an array (name[index])
+func (p *Parser) ParseArrayAccess() *nast.ArrayAccess {
+	p.Log()
+	if !p.IsCurrentType(ast.TypeID) || p.NextToken.Type != ast.TypeSymbol || p.NextToken.Value != "[" {
+		return nil
+	}
+	access := &nast.ArrayAccess{
+		Position: p.CurrentToken.Position,
+		Array:    p.CurrentToken.Value,
+	}
+	p.Advance()
+	p.Advance()
+	access.Index = p.This.ParseExpression()
+	if access.Index == nil {
+		p.ErrorCurrent("Expected an expression as index of the array")
+		access.Index = &ast.NumberConstant{
+			Position: p.CurrentToken.Position,
+			Value:    "0",
+		}
+	}
+	p.Expect(ast.TypeSymbol, "]")
+	return access
+}
+
+// ParseArrayAssignment parses the assignment to an element of an array (name[index] = value)
+func (p *Parser) ParseArrayAssignment() *nast.ArrayAssignment {
+	p.Log()
+	access := p.ParseArrayAccess()
+	if access == nil {
+		return nil
+	}
+	assignment := &nast.ArrayAssignment{
+		Position: access.Position,
+		Array:    access.Array,
+		Index:    access.Index,
+	}
+	assignmentOperators := []string{"=", "+=", "-=", "*=", "/=", "%="}
+	for _, op := range assignmentOperators {
+		if p.IsCurrent(ast.TypeSymbol, op) {
+			assignment.Operator = op
+		}
+	}
+	if assignment.Operator == "" {
+		p.ErrorCurrent("Expected an assignment-operator after the element of the array")
+		return assignment
+	}
+	p.Advance()
+	assignment.Value = p.This.ParseExpression()
+	if assignment.Value == nil {
+		p.ErrorCurrent("Expected expression on right side of assignment")
+		assignment.Value = &ast.NumberConstant{
+			Position: p.CurrentToken.Position,
+			Value:    "0",
+		}
+	}
+	return assignment
+}
+
 // ParseBreak parses the break keyword
 func (p *Parser) ParseBreak() ast.Statement {
 	p.Log()
@@ -556,6 +1311,7 @@ func (p *Parser) ParseBreak() ast.Statement {
 			Position: p.CurrentToken.Position,
 		}
 		p.Advance()
+		rval.Label = p.parseLoopReference()
 		return rval
 	}
 	return nil
@@ -569,7 +1325,18 @@ func (p *Parser) ParseContinue() ast.Statement {
 			Position: p.CurrentToken.Position,
 		}
 		p.Advance()
+		rval.Label = p.parseLoopReference()
 		return rval
 	}
 	return nil
 }
+
+// parseLoopReference parses the optional label of the loop a break or continue refers to
+func (p *Parser) parseLoopReference() string {
+	if p.IsCurrentType(ast.TypeID) && !strings.HasPrefix(p.CurrentToken.Value, ":") {
+		label := strings.ToLower(p.CurrentToken.Value)
+		p.Advance()
+		return label
+	}
+	return ""
+}
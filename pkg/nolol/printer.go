@@ -46,6 +46,21 @@ func (np *Printer) handleNololNodes(node ast.Node, visitType int, p *parser.Prin
 		}
 		break
 
+	case *nast.DynamicGoToStatement:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("goto")
+			p.Space()
+			p.Write("[")
+			p.Write(strings.Join(n.Labels, ", "))
+			p.Write("][")
+			break
+		case ast.PostVisit:
+			p.Write("]")
+			break
+		}
+		break
+
 	case *nast.Block:
 		switch visitType {
 		case ast.PreVisit:
@@ -69,9 +84,25 @@ func (np *Printer) handleNololNodes(node ast.Node, visitType int, p *parser.Prin
 			p.Write("(")
 			p.Write(arglist)
 			p.Write(")")
+			if n.Expression != nil {
+				p.OptionalSpace()
+				p.Write("=")
+				p.OptionalSpace()
+				break
+			}
+			if n.Result != "" {
+				p.Space()
+				p.Write("returns")
+				p.Space()
+				p.Write(n.Result)
+			}
 			p.Newline()
 			break
 		case ast.PostVisit:
+			if n.Expression != nil {
+				p.Newline()
+				break
+			}
 			p.Write("end")
 			break
 		}
@@ -136,9 +167,118 @@ func (np *Printer) handleNololNodes(node ast.Node, visitType int, p *parser.Prin
 			}
 		}
 		break
+	case *nast.SwitchStatement:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("switch")
+			p.Space()
+			break
+		case ast.InterVisit1:
+			p.Newline()
+			break
+		case ast.InterVisit2:
+			p.Write(np.indentation())
+			p.Write("default")
+			p.Newline()
+			break
+		case ast.PostVisit:
+			p.Write(np.indentation())
+			p.Write("end")
+			p.Newline()
+			break
+		}
+		break
+	case *nast.SwitchCase:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write(np.indentation())
+			p.Write("case")
+			p.Space()
+			break
+		case ast.InterVisit1:
+			p.Newline()
+			break
+		case ast.PostVisit:
+			break
+		default:
+			if visitType > 0 {
+				p.Write(",")
+				p.OptionalSpace()
+			}
+		}
+		break
+	case *nast.CompileTimeIf:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("#if")
+			p.Space()
+			break
+		case ast.InterVisit1:
+			p.Newline()
+			break
+		case ast.InterVisit2:
+			p.Write(np.indentation())
+			p.Write("#else")
+			p.Newline()
+			break
+		case ast.PostVisit:
+			p.Write(np.indentation())
+			p.Write("#end")
+			p.Newline()
+			break
+		default:
+		}
+		break
+	case *nast.DoWhileLoop:
+		switch visitType {
+		case ast.PreVisit:
+			np.printLoopLabel(n.Label)
+			p.Write("do")
+			p.Newline()
+			break
+		case ast.InterVisit1:
+			p.Write(np.indentation())
+			p.Write("while")
+			p.Space()
+			break
+		case ast.PostVisit:
+			p.Newline()
+			break
+		}
+		break
+	case *nast.ForLoop:
+		switch visitType {
+		case ast.PreVisit:
+			np.printLoopLabel(n.Label)
+			p.Write("for")
+			p.Space()
+			p.Write(n.Variable)
+			p.OptionalSpace()
+			p.Write("=")
+			p.OptionalSpace()
+			break
+		case ast.InterVisit1:
+			p.Space()
+			p.Write("to")
+			p.Space()
+			break
+		case ast.InterVisit2:
+			p.Space()
+			p.Write("do")
+			p.Newline()
+			break
+		case ast.PostVisit:
+			p.Write(np.indentation())
+			p.Write("end")
+			p.Newline()
+			break
+		default:
+		}
+		break
 	case *nast.WhileLoop:
 		switch visitType {
 		case ast.PreVisit:
+			np.printLoopLabel(n.Label)
 			p.Write("while")
 			p.Space()
 			break
@@ -157,6 +297,10 @@ func (np *Printer) handleNololNodes(node ast.Node, visitType int, p *parser.Prin
 	case *nast.StatementLine:
 		switch visitType {
 		case ast.PreVisit:
+			if n.PinnedLine != 0 {
+				p.Write(fmt.Sprintf("@line %d", n.PinnedLine))
+				p.Space()
+			}
 			if n.Label != "" {
 				p.Write(n.Label)
 				p.Write(">")
@@ -192,6 +336,12 @@ func (np *Printer) handleNololNodes(node ast.Node, visitType int, p *parser.Prin
 		p.Write("include")
 		p.Space()
 		p.Write("\"" + n.File + "\"")
+		if n.Namespace != "" {
+			p.Space()
+			p.Write("as")
+			p.Space()
+			p.Write(n.Namespace)
+		}
 		p.Newline()
 		break
 	case *nast.Definition:
@@ -211,38 +361,184 @@ func (np *Printer) handleNololNodes(node ast.Node, visitType int, p *parser.Prin
 	case *nast.Program:
 		break
 	case *nast.WaitDirective:
-		if visitType == ast.PreVisit {
+		switch visitType {
+		case ast.PreVisit:
 			p.Write("wait")
 			p.Space()
 			break
-		}
-		if n.Statements != nil {
-			if visitType == ast.InterVisit1 {
+		case ast.InterVisit2:
+			p.Space()
+			p.Write("timeout")
+			p.Space()
+			break
+		case ast.InterVisit1:
+			if n.Statements != nil {
 				p.Space()
 				p.Write("then")
 				p.Space()
-				break
 			}
+			break
+		case ast.InterVisit3:
+			p.Space()
+			p.Write("else")
+			p.Space()
+			break
+		case ast.PostVisit:
+			if n.Statements != nil || n.Else != nil {
+				p.Space()
+				p.Write("end")
+			}
+			break
+		default:
 			if visitType > 0 {
 				p.OptionalSpace()
 				p.Write(";")
 				p.OptionalSpace()
-				break
-			}
-			if visitType == ast.PostVisit {
-				p.Space()
-				p.Write("end")
-				break
 			}
 		}
 		break
+	case *nast.Sleep:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("sleep(")
+			break
+		case ast.PostVisit:
+			p.Write(")")
+			p.Newline()
+			break
+		}
+		break
+	case *nast.ChipBoundary:
+		p.Write("#chip")
+		p.Newline()
+		break
 	case *nast.BreakStatement:
 		p.Write("break")
 		p.Space()
+		if n.Label != "" {
+			p.Write(n.Label)
+			p.Space()
+		}
 		break
 	case *nast.ContinueStatement:
 		p.Write("continue")
 		p.Space()
+		if n.Label != "" {
+			p.Write(n.Label)
+			p.Space()
+		}
+		break
+	case *nast.ArrayDeclaration:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("array")
+			p.Space()
+			p.Write(n.Name)
+			p.Write("[")
+			break
+		case ast.InterVisit1:
+			p.Space()
+			p.Write("to")
+			p.Space()
+			break
+		case ast.PostVisit:
+			p.Write("]")
+			p.Newline()
+			break
+		}
+		break
+	case *nast.ArrayAccess:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write(n.Array)
+			p.Write("[")
+			break
+		case ast.PostVisit:
+			p.Write("]")
+			break
+		}
+		break
+	case *nast.ArrayAssignment:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write(n.Array)
+			p.Write("[")
+			break
+		case ast.InterVisit1:
+			p.Write("]")
+			p.OptionalSpace()
+			p.Write(n.Operator)
+			p.OptionalSpace()
+			break
+		}
+		break
+	case *nast.Assertion:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("assert")
+			p.Space()
+			break
+		case ast.PostVisit:
+			if n.Message != "" {
+				p.Write(",")
+				p.Space()
+				p.Write("\"" + n.Message + "\"")
+			}
+			p.Newline()
+			break
+		}
+		break
+	case *nast.DebugBlock:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("debug")
+			p.Newline()
+			break
+		case ast.PostVisit:
+			p.Write(np.indentation())
+			p.Write("end")
+			p.Newline()
+			break
+		}
+		break
+	case *nast.RawYololBlock:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("yolol")
+			p.Newline()
+			np.indentLevel++
+			break
+		case ast.PostVisit:
+			np.indentLevel--
+			p.Write(np.indentation())
+			p.Write("end")
+			p.Newline()
+			break
+		default:
+			p.Write(np.indentation())
+			if n.Labels[visitType] != "" {
+				p.Write(n.Labels[visitType])
+				p.Write(">")
+				p.Space()
+			}
+		}
+		break
+	case *nast.LocalDeclaration:
+		switch visitType {
+		case ast.PreVisit:
+			p.Write("local")
+			p.Space()
+			p.Write(n.Name)
+			if n.Value != nil {
+				p.OptionalSpace()
+				p.Write("=")
+				p.OptionalSpace()
+			}
+			break
+		case ast.PostVisit:
+			p.Newline()
+			break
+		}
 		break
 	default:
 		return fmt.Errorf("Unknown node-type: %T", node)
@@ -250,6 +546,14 @@ func (np *Printer) handleNololNodes(node ast.Node, visitType int, p *parser.Prin
 	return nil
 }
 
+// printLoopLabel prints the label of a loop (if it has one)
+func (np *Printer) printLoopLabel(label string) {
+	if label != "" {
+		np.yololPrinter.Write(label + ":")
+		np.yololPrinter.Space()
+	}
+}
+
 // Print returns the nolol-code for the given ast
 func (np *Printer) Print(prog ast.Node) (string, error) {
 	np.indentLevel = 0
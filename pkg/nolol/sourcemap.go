@@ -0,0 +1,119 @@
+package nolol
+
+import (
+	"sort"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// SourceMap maps the statements of a generated yolol-program back to the nolol-code they have been generated from
+type SourceMap struct {
+	// the yolol-file this source-map belongs to
+	File     string    `json:"file,omitempty"`
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Mapping maps a range of a yolol-line to a location in the nolol-source
+type Mapping struct {
+	// line of the generated yolol-code (starting at 1)
+	Line int `json:"line"`
+	// the first coloumn of the range (starting at 1)
+	StartColumn int `json:"startColumn"`
+	// the coloumn right after the range
+	EndColumn int `json:"endColumn"`
+	// the nolol-file the code came from
+	Source string `json:"source"`
+	// line in the nolol-file
+	SourceLine int `json:"sourceLine"`
+	// coloumn in the nolol-file
+	SourceColumn int `json:"sourceColumn"`
+	// the macro-insertions the code has been inserted by. The outermost insertion comes first
+	Expansions []MacroExpansion `json:"expansions,omitempty"`
+}
+
+// MacroExpansion describes the insertion of a macro
+type MacroExpansion struct {
+	// name of the inserted macro
+	Macro string `json:"macro"`
+	// file, line and coloumn of the insert-statement
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// sourceName returns the name of the file the given position belongs to
+func (c *Converter) sourceName(pos ast.Position) string {
+	if pos.File != "" {
+		return pos.File
+	}
+	return c.mainfile
+}
+
+// GenerateSourceMap prints the given program (that must have been generated by this converter) using the given printer.
+// Returns the printed code and a source-map for it
+func (c *Converter) GenerateSourceMap(printer *parser.Printer, prog *ast.Program) (string, *SourceMap, error) {
+	sm := &SourceMap{
+		Mappings: []Mapping{},
+	}
+
+	oldCallback := printer.StatementCallback
+	defer func() {
+		printer.StatementCallback = oldCallback
+	}()
+
+	printer.StatementCallback = func(stmt ast.Statement, start ast.Position, end ast.Position) {
+		pos := stmt.Start()
+		if pos.Line == 0 {
+			// the statement has been generated by the compiler and has no source
+			return
+		}
+		sm.Mappings = append(sm.Mappings, Mapping{
+			Line:         start.Line,
+			StartColumn:  start.Coloumn,
+			EndColumn:    end.Coloumn,
+			Source:       c.sourceName(pos),
+			SourceLine:   pos.Line,
+			SourceColumn: pos.Coloumn,
+			Expansions:   c.findExpansions(stmt),
+		})
+	}
+
+	code, err := printer.Print(prog)
+	if err != nil {
+		return "", nil, err
+	}
+	return code, sm, nil
+}
+
+// findExpansions returns the macro-insertions the given statement (or one of its children) has been inserted by
+func (c *Converter) findExpansions(stmt ast.Statement) []MacroExpansion {
+	var found []MacroExpansion
+	stmt.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if exp, exists := c.nodeExpansions[node]; exists && len(exp) > len(found) {
+			found = exp
+		}
+		return nil
+	}))
+	return found
+}
+
+// Lookup returns all mappings that contain the given yolol-position. The innermost mapping comes last.
+// If column is 0, all mappings of the line are returned
+func (sm *SourceMap) Lookup(line int, column int) []Mapping {
+	found := []Mapping{}
+	for _, m := range sm.Mappings {
+		if m.Line != line {
+			continue
+		}
+		if column != 0 && (column < m.StartColumn || column >= m.EndColumn) {
+			continue
+		}
+		found = append(found, m)
+	}
+	// statements inside of ifs are printed before the if is complete. Order by length of the range instead
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].EndColumn-found[i].StartColumn > found[j].EndColumn-found[j].StartColumn
+	})
+	return found
+}
@@ -0,0 +1,21 @@
+package stdlib
+
+var mathLibrary = `// std/math contains macros for common calculations
+// The arguments are evaluated multiple times. Do not pass expressions with side-effects (like x++)
+
+// min sets result to the smaller one of a and b
+macro min(a, b, result)
+	result = a + (b - a) * (b < a)
+end
+
+// max sets result to the larger one of a and b
+macro max(a, b, result)
+	result = a + (b - a) * (b > a)
+end
+
+// clamp limits value to the range from low to high
+macro clamp(value, low, high)
+	value += (low - value) * (value < low)
+	value += (high - value) * (value > high)
+end
+`
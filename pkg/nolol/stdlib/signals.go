@@ -0,0 +1,41 @@
+package stdlib
+
+var signalsLibrary = `// std/signals contains macros for processing inputs (like buttons) and generating signals
+// Every insertion of these macros has its own state. Insert them once (for example inside a loop) for every signal to process
+
+// rising sets result to 1 if input has changed from false to true since the last execution of this insertion. Otherwise to 0
+macro rising(input, result)
+	result = input and not last
+	last = input
+end
+
+// falling sets result to 1 if input has changed from true to false since the last execution of this insertion. Otherwise to 0
+macro falling(input, result)
+	result = last and not input
+	last = input
+end
+
+// changed sets result to 1 if input has changed since the last execution of this insertion. Otherwise to 0
+macro changed(input, result)
+	result = input != last
+	last = input
+end
+
+// debounce sets result to input, once input has kept the same value for the given number of executions of this insertion
+macro debounce(input, executions, result)
+	stable = (stable + 1) * (input == last)
+	last = input
+	if stable >= executions then
+		result = input
+	end
+end
+
+// blink toggles output between 0 and 1 after every period executions of this insertion
+macro blink(output, period)
+	count++
+	if count >= period then
+		count = 0
+		output = not output
+	end
+end
+`
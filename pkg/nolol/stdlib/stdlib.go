@@ -0,0 +1,42 @@
+// Package stdlib contains the standard-library of nolol.
+// The libraries can be included using include "std/<name>"
+package stdlib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Prefix is the prefix of all included files that are served from the standard-library
+const Prefix = "std/"
+
+var libraries = map[string]string{
+	"strings": stringsLibrary,
+	"math":    mathLibrary,
+	"signals": signalsLibrary,
+}
+
+// IsStdlib returns true if the given include-path refers to the standard-library
+func IsStdlib(name string) bool {
+	return strings.HasPrefix(name, Prefix)
+}
+
+// Get returns the source-code of the library with the given include-path (for example "std/strings")
+func Get(name string) (string, error) {
+	lib, exists := libraries[strings.TrimSuffix(strings.TrimPrefix(name, Prefix), ".nolol")]
+	if !exists {
+		return "", fmt.Errorf("The standard-library does not contain '%s'. Available are: %s", name, strings.Join(Names(), ", "))
+	}
+	return lib, nil
+}
+
+// Names returns the include-paths of all available libraries
+func Names() []string {
+	names := make([]string, 0, len(libraries))
+	for name := range libraries {
+		names = append(names, Prefix+name)
+	}
+	sort.Strings(names)
+	return names
+}
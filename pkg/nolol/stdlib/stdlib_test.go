@@ -0,0 +1,41 @@
+package stdlib_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yodktesting "github.com/dbaumgarten/yodk/pkg/testing"
+)
+
+func TestLibraries(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), "_test.yaml") {
+			continue
+		}
+		testfile := filepath.Join("testdata", file.Name())
+		t.Run(file.Name(), func(t *testing.T) {
+			content, err := ioutil.ReadFile(testfile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			absolutePath, _ := filepath.Abs(testfile)
+			test, err := yodktesting.Parse(content, absolutePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fails := test.Run(nil)
+			for _, fail := range fails {
+				t.Log(fail)
+			}
+			if len(fails) != 0 {
+				t.FailNow()
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package stdlib
+
+var stringsLibrary = `// std/strings contains macros for working with strings
+// The string-arguments must be variables. Results are written to the variable given as last argument
+
+// length sets result to the number of characters in str
+macro length(str, result)
+	tmp = str
+	result = 0
+	while tmp != "" do
+		tmp--
+		result++
+	end
+end
+
+// padleft prepends fill to str, until str is at least width characters long
+macro padleft(str, width, fill)
+	insert length(str, len)
+	while len < width do
+		str = fill + str
+		len++
+	end
+end
+
+// padright appends fill to str, until str is at least width characters long
+macro padright(str, width, fill)
+	insert length(str, len)
+	while len < width do
+		str += fill
+		len++
+	end
+end
+
+// right sets result to the last n characters of str (or to str, if it is shorter)
+macro right(str, n, result)
+	tmp = str
+	result = ""
+	count = 0
+	while tmp != "" and count < n do
+		last = tmp
+		tmp--
+		// removing all but the last character leaves only the last character
+		result = last - tmp + result
+		count++
+	end
+end
+
+// fixed converts number to a string with exactly the given number (0-3) of decimal places. Additional decimals are truncated
+macro fixed(number, decimals, result)
+	scale = 10 ^ decimals
+	value = number * scale
+	result = "" + (value - value % 1) / scale
+	if decimals > 0 then
+		// count the decimal places that are already present
+		tmp = result
+		found = 0
+		present = 0
+		while tmp != "" and not found do
+			last = tmp
+			tmp--
+			if last - tmp == "." then
+				found = 1
+			else
+				present++
+			end
+		end
+		if not found then
+			result += "."
+			present = 0
+		end
+		while present < decimals do
+			result += "0"
+			present++
+		end
+	end
+end
+`
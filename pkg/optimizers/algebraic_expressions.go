@@ -0,0 +1,304 @@
+package optimizers
+
+import (
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// AlgebraicOptimizer applies algebraic simplifications to expressions, like x*1 -> x
+// As + also concatenates strings, most rewrites are only safe if the types of the operands are known.
+// Expressions whose type can not be determined at compile-time are left unchanged.
+// Local variables that are only ever assigned numbers are known to be numbers.
+// A rewrite is only performed if it makes the expression shorter.
+type AlgebraicOptimizer struct {
+	seopt *StaticExpressionOptimizer
+	// the local variables that are known to contain numbers. Only set while optimizing a whole program
+	numberVars map[string]bool
+}
+
+// NewAlgebraicOptimizer returns a new AlgebraicOptimizer
+func NewAlgebraicOptimizer() *AlgebraicOptimizer {
+	return &AlgebraicOptimizer{
+		seopt: NewStaticExpressionOptimizer(),
+	}
+}
+
+// Optimize is needed to implement Optimizer
+// The types of the local variables are determined using the whole program
+func (o *AlgebraicOptimizer) Optimize(prog ast.Node) error {
+	o.numberVars = numberVariables(prog)
+	defer func() {
+		o.numberVars = nil
+	}()
+	return prog.Accept(o)
+}
+
+// OptimizeExpression optimizes a single expression recursively
+func (o *AlgebraicOptimizer) OptimizeExpression(e ast.Expression) ast.Expression {
+	e, _ = ast.AcceptChild(o, e)
+	return e
+}
+
+// Visit is needed to implement the Visitor interface
+func (o *AlgebraicOptimizer) Visit(node ast.Node, visitType int) error {
+	if visitType == ast.PostVisit {
+		if exp, isexp := node.(ast.Expression); isexp {
+			optimized := o.OptimizeExpressionNonRecursive(exp)
+			if optimized != nil {
+				return ast.NewNodeReplacementSkip(optimized)
+			}
+		}
+	}
+	return nil
+}
+
+// OptimizeExpressionNonRecursive applies the simplification rules to the given expression, until no rule matches anymore.
+// The children of the expression are not optimized.
+// if no optimization is possible, nil is returned
+func (o *AlgebraicOptimizer) OptimizeExpressionNonRecursive(exp ast.Expression) ast.Expression {
+	var result ast.Expression
+	for {
+		simplified := o.simplify(exp, o.numberVars)
+		if simplified == nil {
+			return result
+		}
+		if static := o.seopt.OptimizeExpressionNonRecursive(simplified); static != nil {
+			simplified = static
+		}
+		if printedLength(simplified) >= printedLength(exp) {
+			return result
+		}
+		exp = simplified
+		result = simplified
+	}
+}
+
+// simplify tries all rewrite-rules on the given expression and returns the result of the first matching one
+// numberVars contains the variables that are known to contain numbers (see numberVariables). It may be nil.
+func (o *AlgebraicOptimizer) simplify(exp ast.Expression, numberVars map[string]bool) ast.Expression {
+	switch n := exp.(type) {
+	case *ast.UnaryOperation:
+		// not not x -> x (only if x is already 0 or 1)
+		if inner, is := n.Exp.(*ast.UnaryOperation); is && n.Operator == "not" && inner.Operator == "not" {
+			if isBoolean(inner.Exp) {
+				return inner.Exp
+			}
+		}
+		// - -x -> x (only for numbers. Negating a string is a runtime-error, which must be kept)
+		if inner, is := n.Exp.(*ast.UnaryOperation); is && n.Operator == "-" && inner.Operator == "-" && expressionType(inner.Exp, numberVars) == typeNumber {
+			return inner.Exp
+		}
+	case *ast.BinaryOperation:
+		if repl := simplifyNeutralElements(n, numberVars); repl != nil {
+			return repl
+		}
+		if repl := simplifyBooleanComparison(n); repl != nil {
+			return repl
+		}
+		if repl := o.reassociate(n, numberVars); repl != nil {
+			return repl
+		}
+	}
+	return nil
+}
+
+// simplifyNeutralElements removes operations with neutral elements like x+0 or x*1
+func simplifyNeutralElements(n *ast.BinaryOperation, numberVars map[string]bool) ast.Expression {
+	if expressionType(n.Exp1, numberVars) != typeNumber || expressionType(n.Exp2, numberVars) != typeNumber {
+		return nil
+	}
+	switch n.Operator {
+	case "+":
+		if isConstantValue(n.Exp1, "0") {
+			return n.Exp2
+		}
+		fallthrough
+	case "-":
+		if isConstantValue(n.Exp2, "0") {
+			return n.Exp1
+		}
+	case "*":
+		if isConstantValue(n.Exp1, "1") {
+			return n.Exp2
+		}
+		fallthrough
+	case "/", "^":
+		if isConstantValue(n.Exp2, "1") {
+			return n.Exp1
+		}
+	}
+	return nil
+}
+
+// simplifyBooleanComparison removes comparisons of boolean expressions (0 or 1) with constants, like (a>b)==1 -> a>b
+func simplifyBooleanComparison(n *ast.BinaryOperation) ast.Expression {
+	exp := n.Exp1
+	constant := n.Exp2
+	operator := n.Operator
+	if isConstant(exp) {
+		exp, constant = constant, exp
+		operator = mirroredComparisons[operator]
+	}
+	if !isBoolean(exp) || !isConstant(constant) || expressionType(constant, nil) != typeNumber {
+		return nil
+	}
+	truthy := map[string]string{
+		"==": "1",
+		"!=": "0",
+		">":  "0",
+		">=": "1",
+	}
+	falsy := map[string]string{
+		"==": "0",
+		"!=": "1",
+		"<":  "1",
+		"<=": "0",
+	}
+	if value, exists := truthy[operator]; exists && isConstantValue(constant, value) {
+		return exp
+	}
+	if value, exists := falsy[operator]; exists && isConstantValue(constant, value) {
+		// (a<b)==0 -> a>=b
+		return negate(exp)
+	}
+	return nil
+}
+
+// mirroredComparisons contains the operators to use, when swapping the operands of a comparison
+var mirroredComparisons = map[string]string{
+	"==": "==",
+	"!=": "!=",
+	"<":  ">",
+	">":  "<",
+	"<=": ">=",
+	">=": "<=",
+}
+
+// reassociate flattens chains of + or * on numbers, moves all constants to the end of the chain and folds them.
+// This also removes parentheses like in a+(b+c).
+// a-(b+c) and a-(b-c) are rewritten to a-b-c and a-b+c.
+func (o *AlgebraicOptimizer) reassociate(n *ast.BinaryOperation, numberVars map[string]bool) ast.Expression {
+	if n.Operator == "-" {
+		inner, isbinary := n.Exp2.(*ast.BinaryOperation)
+		if !isbinary || (inner.Operator != "+" && inner.Operator != "-") {
+			return nil
+		}
+		if !allNumbers(numberVars, n.Exp1, inner.Exp1, inner.Exp2) || hasSideEffects(n) {
+			return nil
+		}
+		op := "-"
+		if inner.Operator == "-" {
+			op = "+"
+		}
+		return &ast.BinaryOperation{
+			Operator: op,
+			Exp1: &ast.BinaryOperation{
+				Operator: "-",
+				Exp1:     n.Exp1,
+				Exp2:     inner.Exp1,
+			},
+			Exp2: inner.Exp2,
+		}
+	}
+
+	if n.Operator != "+" && n.Operator != "*" {
+		return nil
+	}
+	operands := flattenChain(n, n.Operator)
+	if !allNumbers(numberVars, operands...) || hasSideEffects(n) {
+		return nil
+	}
+
+	var constant ast.Expression
+	var result ast.Expression
+	for _, operand := range operands {
+		if isConstant(operand) {
+			if constant == nil {
+				constant = operand
+				continue
+			}
+			folded := o.seopt.OptimizeExpressionNonRecursive(&ast.BinaryOperation{
+				Operator: n.Operator,
+				Exp1:     constant,
+				Exp2:     operand,
+			})
+			if folded == nil {
+				return nil
+			}
+			constant = folded
+			continue
+		}
+		if result == nil {
+			result = operand
+			continue
+		}
+		result = &ast.BinaryOperation{
+			Operator: n.Operator,
+			Exp1:     result,
+			Exp2:     operand,
+		}
+	}
+	if result == nil {
+		return constant
+	}
+	if constant != nil {
+		result = &ast.BinaryOperation{
+			Operator: n.Operator,
+			Exp1:     result,
+			Exp2:     constant,
+		}
+	}
+	return result
+}
+
+// flattenChain returns the operands of a chain of binary operations with the given operator
+func flattenChain(exp ast.Expression, operator string) []ast.Expression {
+	if bin, is := exp.(*ast.BinaryOperation); is && bin.Operator == operator {
+		return append(flattenChain(bin.Exp1, operator), flattenChain(bin.Exp2, operator)...)
+	}
+	return []ast.Expression{exp}
+}
+
+// allNumbers returns true if all of the given expressions are known to be numbers
+func allNumbers(numberVars map[string]bool, exps ...ast.Expression) bool {
+	for _, exp := range exps {
+		if expressionType(exp, numberVars) != typeNumber {
+			return false
+		}
+	}
+	return true
+}
+
+// hasSideEffects returns true if evaluating the expression modifies variables
+func hasSideEffects(exp ast.Expression) bool {
+	found := false
+	exp.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && deref.Operator != "" {
+			found = true
+		}
+		return nil
+	}))
+	return found
+}
+
+// isConstantValue returns true if exp is a number-constant with the given value
+func isConstantValue(exp ast.Expression, value string) bool {
+	if !isConstant(exp) || expressionType(exp, nil) != typeNumber {
+		return false
+	}
+	return constToVar(exp).Equals(vm.VariableFromString(value))
+}
+
+// printedLength returns the length of the yolol-code for the given node
+func printedLength(node ast.Node) int {
+	printer := parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	code, err := printer.Print(node)
+	if err != nil {
+		// the node contains nodes the yolol-printer does not know. Never prefer it.
+		return 1 << 30
+	}
+	return len(code)
+}
@@ -0,0 +1,78 @@
+package optimizers
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/testdata"
+)
+
+var algebraicCases = map[string]string{
+	"a=:b*1":            "a=:b*1",
+	"a=(:b+c)*1":        "a=(:b+c)*1",
+	"a=(b*c)*1":         "a=b*c",
+	"a=1*(b/c)":         "a=b/c",
+	"a=(b*c)+0":         "a=b*c",
+	"a=\"x\"+0":         "a=\"x\"+0",
+	"a=:b+0":            "a=:b+0",
+	"a=(:b-c)/1":        "a=(:b-c)/1",
+	"a=-b^1":            "a= -b",
+	"a=- -:b":           "a= - -:b",
+	"a=- -(b*c)":        "a=b*c",
+	"a=not not (b>c)":   "a=b>c",
+	"a=not not b":       "a=not not b",
+	"a=(b>c)!=0":        "a=b>c",
+	"a=0==(b<c)":        "a=b>=c",
+	"a=(b==c)<1":        "a=b!=c",
+	"a=(b or c)==0":     "a=(b or c)==0",
+	"a=1+b*c+2":         "a=b*c+3",
+	"a=2*(b%c)*3":       "a=b%c*6",
+	"a=b*2*c++*3":       "a=b*2*c++ *3",
+	"a=b*c+(d/e+f*g)":   "a=b*c+d/e+f*g",
+	"a=b*c-(d/e+f*g)":   "a=b*c-d/e-f*g",
+	"a=b*c-(d/e-f*g)":   "a=b*c-d/e+f*g",
+	"a=:b+(c+d)":        "a=:b+(c+d)",
+	"a=\"s\"+(2*b+1)+2": "a=\"s\"+(2*b+1)+2",
+}
+
+// these cases depend on the types of the local variables, which are only known when optimizing a whole program
+var algebraicProgramCases = map[string]string{
+	"x=1 y=x+0 :o=y*1": "x=1 y=x :o=y",
+	"a=b+0":            "a=b",
+	"a=- -b":           "a=b",
+	"x=:i y=x+0":       "x=:i y=x+0",
+	"x=\"s\" :o=x+0":   "x=\"s\" :o=x+0",
+}
+
+func TestAlgebraicExpressions(t *testing.T) {
+	optimizationTesting(t, NewAlgebraicOptimizer(), algebraicCases)
+}
+
+func TestAlgebraicExpressionsExp(t *testing.T) {
+	expressionOptimizationTesting(t, NewAlgebraicOptimizer(), algebraicCases)
+}
+
+func TestAlgebraicNumberVariables(t *testing.T) {
+	optimizationTesting(t, NewAlgebraicOptimizer(), algebraicProgramCases)
+}
+
+func TestAlgebraicProgram(t *testing.T) {
+	p := parser.NewParser()
+	parsed, err := p.Parse(testdata.TestProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewAlgebraicOptimizer().Optimize(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := parser.Printer{}
+	generated, err := gen.Print(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testdata.ExecuteTestProgram(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
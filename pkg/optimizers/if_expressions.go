@@ -0,0 +1,274 @@
+package optimizers
+
+import (
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// IfExpressionOptimizer replaces if-statements that only assign values with equivalent (but shorter) expressions.
+// For example:
+// if a>b then c=1 else c=0 end -> c=a>b
+// if a>b then c=5 else c=2 end -> c=2+3*(a>b)
+// if x then y+=5 end -> y+=5*(x!=0) (only if y is known to be a number)
+// A rewrite is only performed if the result is shorter then the original if.
+type IfExpressionOptimizer struct {
+	numberVariables map[string]bool
+	algopt          *AlgebraicOptimizer
+}
+
+// NewIfExpressionOptimizer returns a new IfExpressionOptimizer
+func NewIfExpressionOptimizer() *IfExpressionOptimizer {
+	return &IfExpressionOptimizer{
+		algopt: NewAlgebraicOptimizer(),
+	}
+}
+
+// Optimize is needed to implement Optimizer
+func (o *IfExpressionOptimizer) Optimize(prog ast.Node) error {
+	o.numberVariables = numberVariables(prog)
+	return prog.Accept(o)
+}
+
+// OptimizeLines acts like Optimize, but only changes the given lines of prog.
+// The types of the variables are still determined using the whole program
+func (o *IfExpressionOptimizer) OptimizeLines(prog *ast.Program, lines []*ast.Line) error {
+	o.numberVariables = numberVariables(prog)
+	for _, line := range lines {
+		err := line.Accept(o)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Visit is needed to implement the Visitor interface
+func (o *IfExpressionOptimizer) Visit(node ast.Node, visitType int) error {
+	if ifstmt, is := node.(*ast.IfStatement); is && visitType == ast.PostVisit {
+		repl := o.OptimizeIf(ifstmt)
+		if repl != nil {
+			return ast.NewNodeReplacementSkip(repl...)
+		}
+	}
+	return nil
+}
+
+// OptimizeIf returns the statements that can replace the given if-statement
+// if no optimization is possible, nil is returned
+func (o *IfExpressionOptimizer) OptimizeIf(ifstmt *ast.IfStatement) []ast.Node {
+	condition := ifstmt.Condition
+	if expressionType(condition, o.numberVariables) != typeNumber || len(ifstmt.IfBlock) == 0 {
+		return nil
+	}
+	if ifstmt.ElseBlock != nil && len(ifstmt.ElseBlock) != len(ifstmt.IfBlock) {
+		return nil
+	}
+
+	// if multiple statements are replaced, the condition is evaluated multiple times.
+	// This is only allowed if the condition does not change anything and the assignments do not change the condition
+	if len(ifstmt.IfBlock) > 1 {
+		if hasSideEffects(condition) {
+			return nil
+		}
+		for _, stmt := range ifstmt.IfBlock {
+			if ass, is := stmt.(*ast.Assignment); is && usesVariable(condition, ass.Variable) {
+				return nil
+			}
+			if deref, is := stmt.(*ast.Dereference); is && usesVariable(condition, deref.Variable) {
+				return nil
+			}
+		}
+	}
+
+	repl := make([]ast.Node, len(ifstmt.IfBlock))
+	for i, stmt := range ifstmt.IfBlock {
+		if i > 0 {
+			// every statement needs its own copy of the condition
+			condition = copyExpression(ifstmt.Condition)
+		}
+		var replacement ast.Statement
+		if ifstmt.ElseBlock == nil {
+			replacement = o.rewriteConditionalUpdate(stmt, condition)
+		} else {
+			replacement = o.rewriteAlternativeAssignment(stmt, ifstmt.ElseBlock[i], condition)
+		}
+		if replacement == nil {
+			return nil
+		}
+		repl[i] = replacement
+	}
+
+	// the replacements are separated by spaces
+	replLength := len(repl) - 1
+	for _, stmt := range repl {
+		replLength += printedLength(stmt)
+	}
+	if replLength >= printedLength(ifstmt) {
+		return nil
+	}
+	return repl
+}
+
+// rewriteAlternativeAssignment rewrites "if cond then v=T else v=F end" to "v=F+(T-F)*cond", for number-constants T and F
+func (o *IfExpressionOptimizer) rewriteAlternativeAssignment(ifstmt ast.Statement, elsestmt ast.Statement, condition ast.Expression) ast.Statement {
+	ifass, isass := ifstmt.(*ast.Assignment)
+	elseass, isass2 := elsestmt.(*ast.Assignment)
+	if !isass || !isass2 || ifass.Operator != "=" || elseass.Operator != "=" || !strings.EqualFold(ifass.Variable, elseass.Variable) {
+		return nil
+	}
+	if !isConstant(ifass.Value) || !isConstant(elseass.Value) || !allNumbers(o.numberVariables, ifass.Value, elseass.Value) {
+		return nil
+	}
+
+	var value ast.Expression
+	if isConstantValue(ifass.Value, "0") && isConstantValue(elseass.Value, "1") {
+		value = negate(condition)
+	} else {
+		diff, err := vm.RunBinaryOperation(constToVar(ifass.Value), constToVar(elseass.Value), "-")
+		if err != nil {
+			return nil
+		}
+		value = o.algopt.OptimizeExpression(&ast.BinaryOperation{
+			Operator: "+",
+			Exp1:     elseass.Value,
+			Exp2: &ast.BinaryOperation{
+				Operator: "*",
+				Exp1:     varToConst(diff, ifass.Position),
+				Exp2:     toBoolean(condition),
+			},
+		})
+	}
+
+	return &ast.Assignment{
+		Position: ifass.Position,
+		Variable: ifass.Variable,
+		Operator: "=",
+		Value:    value,
+	}
+}
+
+// rewriteConditionalUpdate rewrites "if cond then v+=K end" to "v+=K*cond" and "if cond then v++ end" to "v+=cond"
+// This only works if v is known to be a number. (Otherwise v+=0 would append "0" to a string)
+func (o *IfExpressionOptimizer) rewriteConditionalUpdate(stmt ast.Statement, condition ast.Expression) ast.Statement {
+	var variable string
+	var operator string
+	var amount ast.Expression
+	var pos ast.Position
+
+	switch n := stmt.(type) {
+	case *ast.Assignment:
+		if n.Operator != "+=" && n.Operator != "-=" {
+			return nil
+		}
+		if !isConstant(n.Value) || !allNumbers(o.numberVariables, n.Value) {
+			return nil
+		}
+		variable = n.Variable
+		operator = n.Operator
+		amount = n.Value
+		pos = n.Position
+	case *ast.Dereference:
+		if !n.IsStatement {
+			return nil
+		}
+		variable = n.Variable
+		operator = string(n.Operator[0]) + "="
+		amount = &ast.NumberConstant{
+			Value:    "1",
+			Position: n.Position,
+		}
+		pos = n.Position
+	default:
+		return nil
+	}
+
+	if !o.numberVariables[strings.ToLower(variable)] {
+		return nil
+	}
+
+	return &ast.Assignment{
+		Position: pos,
+		Variable: variable,
+		Operator: operator,
+		Value: o.algopt.OptimizeExpression(&ast.BinaryOperation{
+			Operator: "*",
+			Exp1:     amount,
+			Exp2:     toBoolean(condition),
+		}),
+	}
+}
+
+// toBoolean returns an expression that is 1 if exp is not 0 and 0 otherwise
+func toBoolean(exp ast.Expression) ast.Expression {
+	if isBoolean(exp) {
+		return exp
+	}
+	return &ast.BinaryOperation{
+		Operator: "!=",
+		Exp1:     exp,
+		Exp2: &ast.NumberConstant{
+			Value:    "0",
+			Position: exp.Start(),
+		},
+	}
+}
+
+// negate returns the shortest version of "not exp"
+func negate(exp ast.Expression) ast.Expression {
+	negated := &ast.UnaryOperation{
+		Operator: "not",
+		Exp:      exp,
+		Position: exp.Start(),
+	}
+	if bin, isbinary := exp.(*ast.BinaryOperation); isbinary {
+		copy := *bin
+		inverted := pushDownNots(&ast.UnaryOperation{
+			Operator: "not",
+			Exp:      &copy,
+			Position: exp.Start(),
+		})
+		if inverted != nil && printedLength(inverted) < printedLength(negated) {
+			return inverted
+		}
+	}
+	return negated
+}
+
+// usesVariable returns true if exp references the given variable
+func usesVariable(exp ast.Expression, variable string) bool {
+	found := false
+	exp.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && strings.EqualFold(deref.Variable, variable) {
+			found = true
+		}
+		return nil
+	}))
+	return found
+}
+
+// copyExpression returns a deep copy of the given expression
+func copyExpression(exp ast.Expression) ast.Expression {
+	switch n := exp.(type) {
+	case *ast.NumberConstant:
+		copy := *n
+		return &copy
+	case *ast.StringConstant:
+		copy := *n
+		return &copy
+	case *ast.Dereference:
+		copy := *n
+		return &copy
+	case *ast.UnaryOperation:
+		copy := *n
+		copy.Exp = copyExpression(n.Exp)
+		return &copy
+	case *ast.BinaryOperation:
+		copy := *n
+		copy.Exp1 = copyExpression(n.Exp1)
+		copy.Exp2 = copyExpression(n.Exp2)
+		return &copy
+	}
+	return exp
+}
@@ -0,0 +1,56 @@
+package optimizers
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/testdata"
+)
+
+var ifExpressionCases = map[string]string{
+	"if a>b then c=1 else c=0 end":            "c=a>b",
+	"if a>b then c=0 else c=1 end":            "c=a<=b",
+	"if a>b then c=5 else c=2 end":            "c=2+3*(a>b)",
+	"if a then c=5 else c=0 end":              "c=5*(a!=0)",
+	"if a>b then c=\"x\" else c=0 end":        "if a>b then c=\"x\" else c=0 end",
+	"if a>b then c=5 else d=2 end":            "if a>b then c=5 else d=2 end",
+	"if a>b then c=1 d=0 else c=0 d=1 end":    "c=a>b d=a<=b",
+	"if a>c then c=1 d=0 else c=0 d=1 end":    "if a>c then c=1 d=0 else c=0 d=1 end",
+	"if a++>b then c=1 d=0 else c=0 d=1 end":  "if a++ >b then c=1 d=0 else c=0 d=1 end",
+	"if a>b then c=1 end":                     "if a>b then c=1 end",
+	"y=0 if x>1 then y+=5 end":                "y=0 y+=5*(x>1)",
+	"if x>1 then y+=5 end":                    "y+=5*(x>1)",
+	"y=\"s\" if x>1 then y+=5 end":            "y=\"s\" if x>1 then y+=5 end",
+	"if x>1 then :y+=5 end":                   "if x>1 then :y+=5 end",
+	"if x>1 then y++ end":                     "y+=x>1",
+	"if x>1 then y-- end":                     "y-=x>1",
+	"if x>1 then y-=1 goto 1 end":             "if x>1 then y-=1 goto 1 end",
+	"if \"s\" then c=1 else c=0 end":          "if \"s\" then c=1 else c=0 end",
+	"z=:a if z then c=1 else c=0 end":         "z=:a if z then c=1 else c=0 end",
+	"if :a==1 then :c=1 else :c=0 end x=:c+1": ":c=:a==1 x=:c+1",
+}
+
+func TestIfExpressions(t *testing.T) {
+	optimizationTesting(t, NewIfExpressionOptimizer(), ifExpressionCases)
+}
+
+func TestIfExpressionProgram(t *testing.T) {
+	p := parser.NewParser()
+	parsed, err := p.Parse(testdata.TestProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewIfExpressionOptimizer().Optimize(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := parser.Printer{}
+	generated, err := gen.Print(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = testdata.ExecuteTestProgram(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,6 +1,11 @@
 package optimizers
 
-import "github.com/dbaumgarten/yodk/pkg/parser/ast"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
 
 // Optimizer is the common interface for all optimizers
 type Optimizer interface {
@@ -14,37 +19,87 @@ type ExpressionOptimizer interface {
 	OptimizeExpression(prog ast.Expression) ast.Expression
 }
 
-// CompoundOptimizer wraps all other optimizers and executes them
+// CompoundOptimizer wraps other optimizers and executes them one after another
 type CompoundOptimizer struct {
-	seopt  *StaticExpressionOptimizer
-	varopt *VariableNameOptimizer
-	comopt *CommentOptimizer
-	expinv *ExpressionInversionOptimizer
+	passes []Pass
 }
 
-// NewCompoundOptimizer creates a new compound optimizer
-func NewCompoundOptimizer() *CompoundOptimizer {
-	return &CompoundOptimizer{
-		seopt:  &StaticExpressionOptimizer{},
-		varopt: NewVariableNameOptimizer(),
-		comopt: &CommentOptimizer{},
-		expinv: &ExpressionInversionOptimizer{},
+// Pass is a single named step of the CompoundOptimizer
+type Pass struct {
+	Name      string
+	Optimizer Optimizer
+}
+
+// PassNames returns the names of all available optimization-passes, in the order they are performed by default
+func PassNames() []string {
+	return []string{"static", "algebraic", "ifexpressions", "comments", "inversion", "varnames"}
+}
+
+// ValidatePasses returns an error if one of the given names is not the name of an optimization-pass
+func ValidatePasses(names []string) error {
+	for _, name := range names {
+		if newOptimizer(name) == nil {
+			return fmt.Errorf("Unknown optimization '%s'. Available optimizations are: %s", name, strings.Join(PassNames(), ", "))
+		}
 	}
+	return nil
 }
 
-// Optimize is required to implement Optimizer
-func (co *CompoundOptimizer) Optimize(prog *ast.Program) error {
-	err := co.seopt.Optimize(prog)
-	if err != nil {
-		return err
+// newOptimizer returns the optimizer for the pass with the given name. Returns nil for unknown names
+func newOptimizer(name string) Optimizer {
+	switch name {
+	case "static":
+		return NewStaticExpressionOptimizer()
+	case "algebraic":
+		return NewAlgebraicOptimizer()
+	case "ifexpressions":
+		return NewIfExpressionOptimizer()
+	case "comments":
+		return &CommentOptimizer{}
+	case "inversion":
+		return &ExpressionInversionOptimizer{}
+	case "varnames":
+		return NewVariableNameOptimizer()
 	}
-	err = co.comopt.Optimize(prog)
+	return nil
+}
+
+// NewCompoundOptimizer creates a new compound optimizer that performs all available passes
+func NewCompoundOptimizer() *CompoundOptimizer {
+	co, _ := NewCompoundOptimizerWithPasses(PassNames())
+	return co
+}
+
+// NewCompoundOptimizerWithPasses creates a new compound optimizer that performs the given passes in the given order
+func NewCompoundOptimizerWithPasses(names []string) (*CompoundOptimizer, error) {
+	err := ValidatePasses(names)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = co.expinv.Optimize(prog)
-	if err != nil {
-		return err
+	passes := make([]Pass, len(names))
+	for i, name := range names {
+		passes[i] = Pass{
+			Name:      name,
+			Optimizer: newOptimizer(name),
+		}
+	}
+	return &CompoundOptimizer{
+		passes: passes,
+	}, nil
+}
+
+// Passes returns the optimizations performed by the CompoundOptimizer, in the order they are performed
+func (co *CompoundOptimizer) Passes() []Pass {
+	return co.passes
+}
+
+// Optimize is required to implement Optimizer
+func (co *CompoundOptimizer) Optimize(prog *ast.Program) error {
+	for _, pass := range co.Passes() {
+		err := pass.Optimizer.Optimize(prog)
+		if err != nil {
+			return err
+		}
 	}
-	return co.varopt.Optimize(prog)
+	return nil
 }
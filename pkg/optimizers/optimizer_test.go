@@ -78,3 +78,58 @@ func expressionOptimizationTesting(t *testing.T, o ExpressionOptimizer, cases ma
 		}
 	}
 }
+
+func TestPassSelection(t *testing.T) {
+	opt, err := NewCompoundOptimizerWithPasses([]string{"varnames", "static"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := parser.NewParser().Parse("foo=1+2 // comment")
+	err = opt.Optimize(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	optimized, _ := printer.Print(parsed)
+	if optimized != "a=3 // comment" {
+		t.Fatalf("Wrong optimized output. Wanted 'a=3 // comment' but got '%s'", optimized)
+	}
+
+	_, err = NewCompoundOptimizerWithPasses([]string{"static", "doesnotexist"})
+	if err == nil {
+		t.Fatal("Selecting an unknown optimization did not return an error")
+	}
+}
+
+func TestOptimizationReport(t *testing.T) {
+	p := parser.NewParser()
+	parsed, err := p.Parse("a=1+2\n\n// comment\nb=a*1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt, _ := NewCompoundOptimizerWithPasses([]string{"static", "comments"})
+	report, err := opt.OptimizeWithReport(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 2 {
+		t.Fatalf("Expected a report for 2 passes, but got %d", len(report))
+	}
+	static := report[0]
+	if static.Name != "static" || static.CharsSaved != 2 || static.LinesSaved != 0 || len(static.ChangedLines) != 1 || static.ChangedLines[0] != 1 {
+		t.Fatalf("Wrong report for the static pass: %v", static)
+	}
+	comments := report[1]
+	if comments.CharsSaved != 10 || comments.LinesSaved != 1 || len(comments.ChangedLines) != 1 || comments.ChangedLines[0] != 3 {
+		t.Fatalf("Wrong report for the comments pass: %v", comments)
+	}
+}
+
+func TestCompareCodeByContent(t *testing.T) {
+	report := CompareCode("test", "a=1\nb=2\nc=3\nd=4", "a=1\nc=3\nd=5")
+	if report.LinesSaved != 1 || report.CharsSaved != 3 || len(report.ChangedLines) != 1 || report.ChangedLines[0] != 3 {
+		t.Fatalf("Wrong report for removed line: %v", report)
+	}
+}
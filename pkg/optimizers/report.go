@@ -0,0 +1,116 @@
+package optimizers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// PassReport describes the changes made by a single optimization-pass
+type PassReport struct {
+	Name string
+	// CharsSaved is the number of characters the pass removed from the program
+	CharsSaved int
+	// LinesSaved is the number of non-empty lines the pass removed from the program
+	LinesSaved int
+	// ChangedLines contains the (1-indexed) numbers of the lines that were changed by the pass
+	ChangedLines []int
+}
+
+// Report describes the changes made by all passes of an optimization
+type Report []PassReport
+
+func (r Report) String() string {
+	txt := fmt.Sprintf("%-15s %12s %12s  %s\n", "Optimization", "Chars saved", "Lines saved", "Changed lines")
+	for _, pass := range r {
+		lines := make([]string, len(pass.ChangedLines))
+		for i, line := range pass.ChangedLines {
+			lines[i] = strconv.Itoa(line)
+		}
+		txt += fmt.Sprintf("%-15s %12d %12d  %s\n", pass.Name, pass.CharsSaved, pass.LinesSaved, strings.Join(lines, ", "))
+	}
+	return txt
+}
+
+// CompareCode compares the code before and after an optimization-pass and returns a report about the differences.
+// The lines are compared by their content, so removing or inserting a line does not mark all following lines as changed.
+// ChangedLines contains the lines of the new code that have been added or modified. Removed lines only show up in LinesSaved.
+func CompareCode(name string, before string, after string) PassReport {
+	beforeLines := strings.Split(strings.TrimRight(before, "\n"), "\n")
+	afterLines := strings.Split(strings.TrimRight(after, "\n"), "\n")
+	report := PassReport{
+		Name:         name,
+		ChangedLines: []int{},
+	}
+	for _, line := range beforeLines {
+		report.CharsSaved += len(line)
+		if line != "" {
+			report.LinesSaved++
+		}
+	}
+	for _, line := range afterLines {
+		report.CharsSaved -= len(line)
+		if line != "" {
+			report.LinesSaved--
+		}
+	}
+
+	// common[i][j] is the length of the longest common subsequence of beforeLines[i:] and afterLines[j:]
+	common := make([][]int, len(beforeLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(afterLines)+1)
+	}
+	for i := len(beforeLines) - 1; i >= 0; i-- {
+		for j := len(afterLines) - 1; j >= 0; j-- {
+			if beforeLines[i] == afterLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for j < len(afterLines) {
+		if i < len(beforeLines) && beforeLines[i] == afterLines[j] {
+			i++
+			j++
+		} else if i < len(beforeLines) && common[i+1][j] >= common[i][j+1] {
+			i++
+		} else {
+			report.ChangedLines = append(report.ChangedLines, j+1)
+			j++
+		}
+	}
+	return report
+}
+
+// OptimizeWithReport acts like Optimize, but additionally returns a report about the changes each pass made
+func (co *CompoundOptimizer) OptimizeWithReport(prog *ast.Program) (Report, error) {
+	printer := parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	before, err := printer.Print(prog)
+	if err != nil {
+		return nil, err
+	}
+	report := make(Report, len(co.passes))
+	for i, pass := range co.passes {
+		err := pass.Optimizer.Optimize(prog)
+		if err != nil {
+			return nil, err
+		}
+		after, err := printer.Print(prog)
+		if err != nil {
+			return nil, err
+		}
+		report[i] = CompareCode(pass.Name, before, after)
+		before = after
+	}
+	return report, nil
+}
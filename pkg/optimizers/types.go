@@ -0,0 +1,107 @@
+package optimizers
+
+import (
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// the types an expression can have at runtime
+const (
+	typeUnknown = iota
+	typeNumber
+	typeString
+)
+
+// expressionType returns the type the given expression will have at runtime.
+// numberVars contains the lowercased names of variables that are known to always contain numbers (see numberVariables). It may be nil.
+// Expressions that depend on the type of other variables have an unknown type.
+// Expressions that produce a runtime-error (and therefore have no value at all) are reported with the type they would have otherwise.
+func expressionType(exp ast.Expression, numberVars map[string]bool) int {
+	switch n := exp.(type) {
+	case *ast.Dereference:
+		if numberVars[strings.ToLower(n.Variable)] {
+			return typeNumber
+		}
+	case *ast.NumberConstant:
+		return typeNumber
+	case *ast.StringConstant:
+		return typeString
+	case *ast.UnaryOperation:
+		return typeNumber
+	case *ast.BinaryOperation:
+		switch n.Operator {
+		case "+", "-":
+			t1 := expressionType(n.Exp1, numberVars)
+			t2 := expressionType(n.Exp2, numberVars)
+			if t1 == typeString || t2 == typeString {
+				return typeString
+			}
+			if t1 == typeNumber && t2 == typeNumber {
+				return typeNumber
+			}
+			return typeUnknown
+		default:
+			// all other operators either return a number, or produce a runtime-error
+			return typeNumber
+		}
+	}
+	return typeUnknown
+}
+
+// isBoolean returns true if the given expression always evaluates to 0 or 1
+func isBoolean(exp ast.Expression) bool {
+	switch n := exp.(type) {
+	case *ast.NumberConstant:
+		return n.Value == "0" || n.Value == "1"
+	case *ast.UnaryOperation:
+		return strings.ToLower(n.Operator) == "not"
+	case *ast.BinaryOperation:
+		switch strings.ToLower(n.Operator) {
+		case "==", "!=", "<", ">", "<=", ">=", "and", "or":
+			return true
+		}
+	}
+	return false
+}
+
+// numberVariables returns the lowercased names of all local variables in prog, that can only ever contain numbers.
+// Local variables are initialized with 0 and can not be modified from outside of the program.
+// If all assignments to such a variable assign numbers, the variable will always contain a number.
+func numberVariables(prog ast.Node) map[string]bool {
+	vars := make(map[string]bool)
+	assignments := make([]*ast.Assignment, 0)
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *ast.Assignment:
+			if visitType == ast.PreVisit && !strings.HasPrefix(n.Variable, ":") {
+				vars[strings.ToLower(n.Variable)] = true
+				assignments = append(assignments, n)
+			}
+		case *ast.Dereference:
+			if !strings.HasPrefix(n.Variable, ":") {
+				vars[strings.ToLower(n.Variable)] = true
+			}
+		}
+		return nil
+	}))
+
+	// start by assuming every variable is a number and remove the ones that receive something else.
+	// repeat until nothing changes, as removing one variable can change the type of other assignments
+	changed := true
+	for changed {
+		changed = false
+		for _, ass := range assignments {
+			name := strings.ToLower(ass.Variable)
+			if !vars[name] {
+				continue
+			}
+			// *=, /= etc. either produce a number or a runtime-error
+			if (ass.Operator == "=" || ass.Operator == "+=" || ass.Operator == "-=") && expressionType(ass.Value, vars) != typeNumber {
+				delete(vars, name)
+				changed = true
+			}
+		}
+	}
+	return vars
+}
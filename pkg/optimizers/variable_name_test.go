@@ -93,3 +93,15 @@ func TestVarOpt(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+var frequencyCases = map[string]string{
+	"x=1\ny=2\ny=y+1\nz=y+x+y": "b=1\na=2\na=a+1\nc=a+b+a",
+	"first=1 :ext=first":       "a=1 :ext=a",
+	"rare=1 OFTEN=2 often++":   "b=1 a=2 a++",
+}
+
+func TestFrequencyOrder(t *testing.T) {
+	for in, expected := range frequencyCases {
+		optimizationTesting(t, NewVariableNameOptimizer(), map[string]string{in: expected})
+	}
+}
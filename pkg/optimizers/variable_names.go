@@ -2,6 +2,7 @@ package optimizers
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/parser/ast"
@@ -10,6 +11,7 @@ import (
 // VariableNameOptimizer replaces variable names with sorter names
 // Names of external variables will be left unchanged
 // Replacements are case-insensitive. "var" and "VaR" will be replaced with the same replacement
+// When optimizing a whole program, the most used variables receive the shortest names
 type VariableNameOptimizer struct {
 	variableMappings map[string]string
 	invertedMappings map[string]string
@@ -27,9 +29,67 @@ func NewVariableNameOptimizer() *VariableNameOptimizer {
 
 // Optimize is needed to implement Optimizer
 func (o *VariableNameOptimizer) Optimize(prog ast.Node) error {
+	o.ReserveNames(VariablesByUsage(prog))
 	return prog.Accept(o)
 }
 
+// ReserveNames assigns replacements to the given variable names in the given order.
+// Names that already have a replacement keep it
+func (o *VariableNameOptimizer) ReserveNames(names []string) {
+	for _, name := range names {
+		o.OptimizeVarName(name)
+	}
+}
+
+// Rename changes the replacements that have already been assigned.
+// renames maps the old replacements to the new ones. Replacements that are not contained in it stay unchanged
+func (o *VariableNameOptimizer) Rename(renames map[string]string) {
+	inverted := make(map[string]string, len(o.invertedMappings))
+	for replacement, original := range o.invertedMappings {
+		if renamed, exists := renames[replacement]; exists {
+			replacement = renamed
+		}
+		inverted[replacement] = original
+		o.variableMappings[strings.ToLower(original)] = replacement
+	}
+	o.invertedMappings = inverted
+}
+
+// VariablesByUsage returns the names of all local variables used in prog.
+// The names are sorted by the number of times they are used, starting with the most used one.
+// Equally often used variables are sorted by their first appearance.
+func VariablesByUsage(prog ast.Node) []string {
+	counts := make(map[string]int)
+	names := make([]string, 0)
+	count := func(name string) {
+		if strings.HasPrefix(name, ":") {
+			return
+		}
+		lname := strings.ToLower(name)
+		if _, exists := counts[lname]; !exists {
+			names = append(names, name)
+		}
+		counts[lname]++
+	}
+	f := func(node ast.Node, visitType int) error {
+		if visitType == ast.SingleVisit || visitType == ast.PreVisit {
+			switch n := node.(type) {
+			case *ast.Assignment:
+				count(n.Variable)
+			case *ast.Dereference:
+				count(n.Variable)
+			}
+		}
+		return nil
+	}
+	prog.Accept(ast.VisitorFunc(f))
+
+	sort.SliceStable(names, func(i, j int) bool {
+		return counts[strings.ToLower(names[i])] > counts[strings.ToLower(names[j])]
+	})
+	return names
+}
+
 // OptimizeVarName replaces a variable name with a new one (if it does not reference an external variable)
 // the same input name will always result in the same output name
 func (o *VariableNameOptimizer) OptimizeVarName(in string) string {
@@ -0,0 +1,261 @@
+package optimizers
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+	"github.com/shopspring/decimal"
+)
+
+// boundaryValues are the values every input-variable is tested with
+var boundaryValues = []string{"0", "1", "-1", "2", "0.5", "-0.001", "1000", "\"\"", "\"a\"", "\"abc\""}
+
+// Verifier checks that an optimized program behaves exactly like the original one.
+// Both programs are run side by side on a VM, once for every boundary-value and for a number of random inputs.
+// The inputs are the global variables read by the program. After running the programs, their global variables are compared.
+type Verifier struct {
+	// Iterations is the number of times the programs are run for every input
+	Iterations int
+	// RandomInputs is the number of random inputs to test (in addition to the boundary-values)
+	RandomInputs int
+	// Seed is used to generate the random inputs. The same seed produces the same inputs
+	Seed int64
+}
+
+// NewVerifier returns a new Verifier with sensible defaults
+func NewVerifier() *Verifier {
+	return &Verifier{
+		Iterations:   10,
+		RandomInputs: 200,
+		Seed:         1,
+	}
+}
+
+// VerificationError is returned if the optimized program behaves differently than the original one
+type VerificationError struct {
+	// Inputs are the values of the global variables that lead to the different behaviour
+	Inputs map[string]*vm.Variable
+	// Variable is the global variable that has different values
+	Variable string
+	// Expected is the value the original program produced. nil if the variable was not set
+	Expected *vm.Variable
+	// Got is the value the optimized program produced. nil if the variable was not set
+	Got *vm.Variable
+	// Pass is the name of the optimization-pass that introduced the difference
+	Pass string
+}
+
+func (e *VerificationError) Error() string {
+	names := make([]string, 0, len(e.Inputs))
+	for name := range e.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	inputs := make([]string, len(names))
+	for i, name := range names {
+		inputs[i] = name + "=" + e.Inputs[name].Repr()
+	}
+	if len(inputs) == 0 {
+		inputs = append(inputs, "<none>")
+	}
+	return fmt.Sprintf("The optimized program behaves differently for the inputs %s: Expected %s to be %s, but got %s. The difference was introduced by the optimization '%s'",
+		strings.Join(inputs, ", "), e.Variable, reprOrUnset(e.Expected), reprOrUnset(e.Got), e.Pass)
+}
+
+func reprOrUnset(v *vm.Variable) string {
+	if v == nil {
+		return "<unset>"
+	}
+	return v.Repr()
+}
+
+// Verify parses the given yolol-code, optimizes it using the given passes and checks that the optimized program behaves like the original.
+// Returns the optimized program. If the behaviour differs, a *VerificationError is returned.
+func (v *Verifier) Verify(code string, passes []Pass) (*ast.Program, error) {
+	p := parser.NewParser()
+	original, err := p.Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := p.Parse(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// keep a copy of the program after every pass, to find out which pass broke something.
+	// The copies are created by printing and re-parsing the code, to also catch errors when printing the optimized code
+	snapshots := make([]*ast.Program, len(passes))
+	for i, pass := range passes {
+		err := pass.Optimizer.Optimize(prog)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[i], err = reparse(prog)
+		if err != nil {
+			return nil, fmt.Errorf("The optimization '%s' produced invalid code: %s", pass.Name, err.Error())
+		}
+	}
+	if len(snapshots) == 0 {
+		return prog, nil
+	}
+	optimized := snapshots[len(snapshots)-1]
+
+	for _, inputs := range v.inputs(readGlobals(original)) {
+		expected := v.run(original, inputs)
+		name, differs := firstDifference(expected, v.run(optimized, inputs))
+		if !differs {
+			continue
+		}
+		verr := &VerificationError{
+			Inputs:   inputs,
+			Variable: name,
+		}
+		for i, snapshot := range snapshots {
+			got := v.run(snapshot, inputs)
+			if name, differs := firstDifference(expected, got); differs {
+				verr.Variable = name
+				verr.Expected = expected[name]
+				verr.Got = got[name]
+				verr.Pass = passes[i].Name
+				break
+			}
+		}
+		return nil, verr
+	}
+
+	return prog, nil
+}
+
+// run executes the program with the given inputs and returns the resulting global variables
+func (v *Verifier) run(prog *ast.Program, inputs map[string]*vm.Variable) map[string]*vm.Variable {
+	machine := vm.Create(prog)
+	// errors in yolol only skip the rest of the line
+	machine.SetErrorHandler(func(*vm.VM, error) bool {
+		return true
+	})
+	machine.SetIterations(0)
+	// goto-loops may never reach the end of the program. Limit the number of lines instead of iterations
+	machine.SetMaxExecutedLines(v.Iterations * len(prog.Lines))
+	for name, value := range inputs {
+		machine.SetVariable(name, value)
+	}
+	machine.Resume()
+	machine.WaitForTermination()
+
+	globals := make(map[string]*vm.Variable)
+	for name, value := range machine.GetVariables() {
+		if strings.HasPrefix(name, ":") {
+			val := value
+			globals[name] = &val
+		}
+	}
+	return globals
+}
+
+// inputs returns the sets of inputs to test the programs with
+func (v *Verifier) inputs(globals []string) []map[string]*vm.Variable {
+	inputs := make([]map[string]*vm.Variable, 0, len(boundaryValues)+v.RandomInputs)
+	for _, value := range boundaryValues {
+		input := make(map[string]*vm.Variable)
+		for _, name := range globals {
+			input[name] = constToVar(parseValue(value))
+		}
+		inputs = append(inputs, input)
+	}
+
+	rnd := rand.New(rand.NewSource(v.Seed))
+	for i := 0; i < v.RandomInputs; i++ {
+		input := make(map[string]*vm.Variable)
+		for _, name := range globals {
+			input[name] = randomValue(rnd)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+// randomValue returns a random boundary-value, integer, decimal or string
+func randomValue(rnd *rand.Rand) *vm.Variable {
+	switch rnd.Intn(4) {
+	case 0:
+		return constToVar(parseValue(boundaryValues[rnd.Intn(len(boundaryValues))]))
+	case 1:
+		return &vm.Variable{Value: decimal.New(int64(rnd.Intn(201)-100), 0)}
+	case 2:
+		return &vm.Variable{Value: decimal.New(int64(rnd.Intn(200001)-100000), -3)}
+	default:
+		letters := make([]byte, rnd.Intn(4))
+		for i := range letters {
+			letters[i] = byte('a' + rnd.Intn(26))
+		}
+		return &vm.Variable{Value: string(letters)}
+	}
+}
+
+// parseValue parses a boundary-value into a constant
+func parseValue(value string) ast.Expression {
+	if strings.HasPrefix(value, "\"") {
+		return &ast.StringConstant{
+			Value: strings.Trim(value, "\""),
+		}
+	}
+	return &ast.NumberConstant{
+		Value: value,
+	}
+}
+
+// readGlobals returns the (lowercased) names of all global variables read by the program
+func readGlobals(prog ast.Node) []string {
+	found := make(map[string]bool)
+	globals := make([]string, 0)
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && strings.HasPrefix(deref.Variable, ":") {
+			name := strings.ToLower(deref.Variable)
+			if !found[name] {
+				found[name] = true
+				globals = append(globals, name)
+			}
+		}
+		return nil
+	}))
+	return globals
+}
+
+// firstDifference returns the (alphabetically) first variable that has different values in the given sets of variables
+func firstDifference(expected map[string]*vm.Variable, got map[string]*vm.Variable) (string, bool) {
+	names := make([]string, 0, len(expected)+len(got))
+	for name := range expected {
+		names = append(names, name)
+	}
+	for name := range got {
+		if _, exists := expected[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		exp, expExists := expected[name]
+		g, gotExists := got[name]
+		if expExists != gotExists || !exp.Equals(g) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// reparse prints the program and parses the result again
+func reparse(prog *ast.Program) (*ast.Program, error) {
+	printer := parser.Printer{
+		Mode: parser.PrintermodeCompact,
+	}
+	code, err := printer.Print(prog)
+	if err != nil {
+		return nil, err
+	}
+	return parser.NewParser().Parse(code)
+}
@@ -0,0 +1,50 @@
+package optimizers
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/testdata"
+)
+
+// brokenOptimizer replaces all additions with subtractions
+type brokenOptimizer struct{}
+
+func (o brokenOptimizer) Optimize(prog ast.Node) error {
+	return prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if bin, is := node.(*ast.BinaryOperation); is && bin.Operator == "+" {
+			bin.Operator = "-"
+		}
+		return nil
+	}))
+}
+
+func TestVerifyCompoundOptimizer(t *testing.T) {
+	code := `
+a=:x*1+0 b=:y/1 if :x>:y then :r=1 else :r=0 end
+if :y then c+=5 end :s=:y+0 :t=a+b+c :u=not not (:x==:y)
+:v=:x^2+2 :w=:x+"abc" z++ :z=z
+`
+	_, err := NewVerifier().Verify(code, NewCompoundOptimizer().Passes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewVerifier().Verify(testdata.TestProgram, NewCompoundOptimizer().Passes())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyDetectsBrokenPass(t *testing.T) {
+	passes := append(NewCompoundOptimizer().Passes(), Pass{"broken", brokenOptimizer{}})
+	_, err := NewVerifier().Verify(":a=:b+1", passes)
+	verr, is := err.(*VerificationError)
+	if !is {
+		t.Fatalf("Expected a VerificationError, but got: %v", err)
+	}
+	if verr.Pass != "broken" || verr.Variable != ":a" {
+		t.Fatalf("Wrong error: %s", verr.Error())
+	}
+	t.Log(verr.Error())
+}
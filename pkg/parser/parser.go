@@ -404,7 +404,7 @@ func (p *Parser) ParseIf() ast.Statement {
 			if stmt2 == nil {
 				break
 			}
-			ret.ElseBlock = append(ret.IfBlock, stmt2)
+			ret.ElseBlock = append(ret.ElseBlock, stmt2)
 		}
 	}
 
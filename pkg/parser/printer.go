@@ -31,6 +31,15 @@ type Printer struct {
 	// If true, at position-information to every printed token.
 	// Does not produce valid yolol, but is usefull for debugging
 	DebugPositions bool
+	// If set, this function is called for every printed statement (including statements inside ifs)
+	// start is the position of the first character of the statement in the printed code, end is the position right after the statement
+	StatementCallback func(stmt ast.Statement, start ast.Position, end ast.Position)
+}
+
+// printedStatement is a statement that is currently being printed
+type printedStatement struct {
+	node  ast.Node
+	start ast.Position
 }
 
 var operatorPriority = map[string]int{
@@ -53,6 +62,9 @@ var operatorPriority = map[string]int{
 
 // Write adds text to the source-code that is currently build
 func (p *Printer) Write(content string) {
+	if content == "" {
+		return
+	}
 	p.text += content
 	p.lastWasSpace = false
 }
@@ -84,6 +96,10 @@ func (p *Printer) StatementSeparator() {
 
 // Newline adds a newline to the source-code that is currently build
 func (p *Printer) Newline() {
+	// spaces at the end of a line are never needed
+	if p.lastWasSpace {
+		p.text = strings.TrimSuffix(p.text, " ")
+	}
 	p.text += "\n"
 	p.lastWasSpace = false
 }
@@ -94,7 +110,24 @@ func (p *Printer) Print(prog ast.Node) (string, error) {
 	p.lastWasSpace = false
 	numberoflines := 0
 	currentline := 0
+	nextIsStatement := false
+	statements := make([]printedStatement, 0)
 	err := prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if p.StatementCallback != nil {
+			if nextIsStatement && (visitType == ast.PreVisit || visitType == ast.SingleVisit) {
+				statements = append(statements, printedStatement{
+					node:  node,
+					start: p.position(false),
+				})
+			}
+			switch node.(type) {
+			case *ast.Line, *ast.IfStatement:
+				// the next node is one of the statements of the line or the if
+				nextIsStatement = visitType >= 0
+			default:
+				nextIsStatement = false
+			}
+		}
 		if (visitType == ast.PreVisit || visitType == ast.SingleVisit) && p.DebugPositions {
 			p.Write(fmt.Sprintf("{%s(%v - %v)", reflect.TypeOf(node).String(), node.Start(), node.End()))
 		}
@@ -190,6 +223,11 @@ func (p *Printer) Print(prog ast.Node) (string, error) {
 		if (visitType == ast.PostVisit || visitType == ast.SingleVisit) && p.DebugPositions {
 			p.Write("}")
 		}
+		if len(statements) > 0 && (visitType == ast.PostVisit || visitType == ast.SingleVisit) && statements[len(statements)-1].node == node {
+			stmt := statements[len(statements)-1]
+			statements = statements[:len(statements)-1]
+			p.StatementCallback(stmt.node, stmt.start, p.position(true))
+		}
 
 		return nil
 	}))
@@ -201,6 +239,16 @@ func (p *Printer) Print(prog ast.Node) (string, error) {
 	return p.text, nil
 }
 
+// position returns the position in the printed code at which the next character will be written
+// if ignoreSpace is true, a trailing space is not counted
+func (p *Printer) position(ignoreSpace bool) ast.Position {
+	text := p.text
+	if ignoreSpace {
+		text = strings.TrimSuffix(text, " ")
+	}
+	return ast.NewPosition("", strings.Count(text, "\n")+1, len(text)-strings.LastIndex(text, "\n"))
+}
+
 func insertEscapesIntoString(in string) string {
 	in = strings.Replace(in, "\n", "\\n", -1)
 	in = strings.Replace(in, "\t", "\\t", -1)
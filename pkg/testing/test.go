@@ -36,6 +36,10 @@ type Script struct {
 	MaxLines int
 	// the content of the script. If empty, it is loaded from disk at run-time
 	Content string
+	// the chip to run (starting at 1), if the nolol-script is split into multiple chips
+	Chip int
+	// the optimization-level used to compile a nolol-script (0, s or fast). Defaults to s
+	Optimization string
 }
 
 // Case defines inputs and expected outputs for a run
@@ -113,13 +117,24 @@ func (t Test) CreateVMs(coord *vm.Coordinator, errF vm.ErrorHandlerFunc) ([]*vm.
 
 		if strings.HasSuffix(script.Name, ".nolol") {
 			conv := nolol.NewConverter()
+			err := conv.SetOptimizationLevel(script.Optimization)
+			if err != nil {
+				return nil, nil, err
+			}
 			file := filepath.Join(filepath.Dir(script.TestPath), script.Name)
-			prog, err := conv.ConvertFile(file)
+			chips, err := conv.ConvertChipsFile(file)
 			translationTables[i] = conv.GetVariableTranslations()
 			if err != nil {
 				return nil, nil, err
 			}
-			v = vm.Create(prog)
+			chip := script.Chip
+			if chip == 0 && len(chips) == 1 {
+				chip = 1
+			}
+			if chip < 1 || chip > len(chips) {
+				return nil, nil, fmt.Errorf("The script %s consists of %d chips. Select one using 'chip' (1-%d)", script.Name, len(chips), len(chips))
+			}
+			v = vm.Create(chips[chip-1])
 		} else {
 			scriptContent, err := script.GetCode()
 			if err != nil {
@@ -133,6 +148,9 @@ func (t Test) CreateVMs(coord *vm.Coordinator, errF vm.ErrorHandlerFunc) ([]*vm.
 		v.SetIterations(script.Iterations)
 		v.SetMaxExecutedLines(script.MaxLines)
 		v.SetErrorHandler(errF)
+		if errF != nil && strings.HasSuffix(script.Name, ".nolol") {
+			v.SetErrorHandler(assertionHandler(script.Name, errF))
+		}
 		v.SetCoordinator(coord)
 		vms[i] = v
 		v.Resume()
@@ -140,6 +158,20 @@ func (t Test) CreateVMs(coord *vm.Coordinator, errF vm.ErrorHandlerFunc) ([]*vm.
 	return vms, translationTables, nil
 }
 
+// assertionHandler returns an error-handler, that reports failed assertions of the nolol-script with the given name
+// using the position of the assertion in the script. All errors are passed on to errF
+func assertionHandler(name string, errF vm.ErrorHandlerFunc) vm.ErrorHandlerFunc {
+	return func(v *vm.VM, err error) bool {
+		if assertion, isassertion := nolol.AssertionFailure(v, err).(*nolol.AssertionError); isassertion {
+			if assertion.Position.File == "" {
+				assertion.Position.File = name
+			}
+			err = assertion
+		}
+		return errF(v, err)
+	}
+}
+
 // CheckResults compares the global variables of coord with the expected results for c
 // and returns found errors
 func (c Case) CheckResults(coord *vm.Coordinator) []error {
@@ -3,6 +3,7 @@ package testing_test
 import (
 	"testing"
 
+	"github.com/dbaumgarten/yodk/pkg/nolol"
 	thistesting "github.com/dbaumgarten/yodk/pkg/testing"
 )
 
@@ -109,3 +110,63 @@ if :number%5==0 then :out+="buzz " end
 		t.Fatalf("Testcase should have 1 error, but had: %d", len(fails))
 	}
 }
+
+func TestFailedAssertion(t *testing.T) {
+	testcase := `scripts: 
+  - name: assertions.nolol
+cases:
+  - name: TestAssertion
+    inputs:
+      n: 5
+`
+	test, err := thistesting.Parse([]byte(testcase), "../../examples/nolol/assertions_test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fails := test.Run(nil)
+	if len(fails) != 1 {
+		t.Fatalf("Testcase should have 1 error, but had: %d", len(fails))
+	}
+	assertion, isassertion := fails[0].(*nolol.AssertionError)
+	if !isassertion {
+		t.Fatalf("Expected a failed assertion, but got: %s", fails[0])
+	}
+	if assertion.Position.File != "assertions.nolol" || assertion.Position.Line != 10 || assertion.Message != "x must not exceed 3" {
+		t.Fatalf("The failed assertion has been reported incorrectly: %s", assertion)
+	}
+}
+
+func TestOptimizationLevel(t *testing.T) {
+	testcase := `scripts: 
+  - name: loops.nolol
+    iterations: 1
+    optimization: 0
+cases:
+  - name: draw
+    outputs:
+      out: |
+        XXXXXX
+        X0000X
+        X0000X
+        X0000X
+        X0000X
+        XXXXXX
+`
+	test, err := thistesting.Parse([]byte(testcase), "../../examples/nolol/loops_test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test.Scripts[0].Optimization != nolol.OptimizeNone {
+		t.Fatalf("The optimization-level has been parsed incorrectly: '%s'", test.Scripts[0].Optimization)
+	}
+	fails := test.Run(nil)
+	if len(fails) > 0 {
+		t.Fatalf("Testcase had errors but should not: %s", fails[0])
+	}
+
+	test.Scripts[0].Optimization = "O9"
+	fails = test.Run(nil)
+	if len(fails) != 1 {
+		t.Fatalf("An unknown optimization-level should cause 1 error, but caused: %d", len(fails))
+	}
+}
@@ -29,6 +29,9 @@ func RunUnaryOperation(arg *Variable, operator string) (*Variable, error) {
 		result.Value = arg.Number().Abs()
 		break
 	case "sqrt":
+		if arg.Number().IsNegative() {
+			return nil, fmt.Errorf("Can not take the square root of a negative number")
+		}
 		v, _ := arg.Number().Float64()
 		result.Value = decimal.NewFromFloat(math.Sqrt(v))
 		break
@@ -43,10 +46,16 @@ func RunUnaryOperation(arg *Variable, operator string) (*Variable, error) {
 		break
 	case "asin":
 		v, _ := arg.Number().Float64()
+		if v < -1 || v > 1 {
+			return nil, fmt.Errorf("The argument of asin must be between -1 and 1")
+		}
 		result.Value = decimal.NewFromFloat(math.Asin(v))
 		break
 	case "acos":
 		v, _ := arg.Number().Float64()
+		if v < -1 || v > 1 {
+			return nil, fmt.Errorf("The argument of acos must be between -1 and 1")
+		}
 		result.Value = decimal.NewFromFloat(math.Acos(v))
 		break
 	case "atan":
@@ -96,9 +105,15 @@ func RunBinaryOperation(arg1 *Variable, arg2 *Variable, operator string) (*Varia
 			endResult.Value = arg1.Number().Div(arg2.Number())
 			break
 		case "%":
+			if arg2.Number().IsZero() {
+				return nil, fmt.Errorf("Can not divide by 0")
+			}
 			endResult.Value = arg1.Number().Mod(arg2.Number())
 			break
 		case "^":
+			if arg1.Number().IsZero() && arg2.Number().IsNegative() {
+				return nil, fmt.Errorf("Can not divide by 0")
+			}
 			endResult.Value = arg1.Number().Pow(arg2.Number())
 			break
 		case "==":
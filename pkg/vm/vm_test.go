@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/dbaumgarten/yodk/pkg/testdata"
+	"github.com/dbaumgarten/yodk/pkg/vm"
 )
 
 func TestOperators(t *testing.T) {
@@ -12,3 +13,23 @@ func TestOperators(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestInvalidArguments(t *testing.T) {
+	cases := []string{"a=1%0", "a=0^-1", "a=sqrt -1", "a=asin 2", "a=acos -2"}
+	for _, c := range cases {
+		v, err := vm.CreateFromSource(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var runtimeErr error
+		v.SetErrorHandler(func(v *vm.VM, err error) bool {
+			runtimeErr = err
+			return true
+		})
+		v.Resume()
+		v.WaitForTermination()
+		if runtimeErr == nil {
+			t.Fatalf("Expected a runtime-error for '%s'", c)
+		}
+	}
+}
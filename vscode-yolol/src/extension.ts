@@ -108,7 +108,15 @@ export function restartLangServer() {
 export function activate(lcontext: ExtensionContext) {
 	context = lcontext
 	const compileCommandHandler = () => {
-		runYodkCommand(["compile", vscode.window.activeTextEditor.document.fileName])
+		const config = workspace.getConfiguration("yolol")
+		const level = config.get("optimization.level", "s")
+		const passes = config.get<string[]>("optimization.passes", [])
+		const args = ["compile", "-O" + level, "--optimizations=" + passes.join(",")]
+		for (const dir of config.get<string[]>("nolol.includePaths", [])) {
+			args.push("-I", dir)
+		}
+		args.push(vscode.window.activeTextEditor.document.fileName)
+		runYodkCommand(args)
 	};
 
 	const optimizeCommandHandler = () => {